@@ -23,7 +23,7 @@ func GetLoginUrlHandle(ctx *gin.Context) {
 	appKey := ctx.Request.Header.Get("AppKey")
 
 	// 获取一个微信机器人对象
-	bot := global.InitWechatBotHandle()
+	bot := global.InitWechatBotHandle(appKey)
 	// 已扫码回调
 	bot.ScanCallBack = func(body openwechat.CheckLoginResponse) {
 		log.Infof("[%v]已扫码", appKey)
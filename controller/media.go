@@ -0,0 +1,92 @@
+package controller
+
+import (
+	"github.com/gin-gonic/gin"
+	"mime"
+	"net/http"
+	"strings"
+	"web-wechat/core"
+	"web-wechat/global"
+	"web-wechat/handler"
+	"web-wechat/oss"
+)
+
+// GetMediaHandle 获取消息的媒体文件，只能获取当前登录用户的消息，支持Range分段请求
+// 参数thumb为true的时候获取缩略图
+func GetMediaHandle(ctx *gin.Context) {
+	// 获取AppKey
+	appKey := ctx.Request.Header.Get("AppKey")
+	self, err := global.GetBot(appKey).GetCurrentUser()
+	if err != nil {
+		core.FailWithMessage("获取登录用户信息失败", ctx)
+		return
+	}
+	doc, err := handler.FindMessageDocument(self.Uin, ctx.Param("messageId"))
+	if err != nil {
+		core.FailWithMessage("查询消息失败："+err.Error(), ctx)
+		return
+	}
+	if doc == nil || doc.Media == nil {
+		core.FailWithMessage("消息不存在或者没有媒体文件", ctx)
+		return
+	}
+	if doc.MediaExpired() {
+		core.FailWithMessage("媒体文件已过期清理", ctx)
+		return
+	}
+	key, contentType := doc.Media.Key, doc.Media.ContentType
+	if ctx.Query("thumb") == "true" {
+		if doc.Media.ThumbKey == "" {
+			core.FailWithMessage("没有缩略图", ctx)
+			return
+		}
+		key, contentType = doc.Media.ThumbKey, "image/jpeg"
+	}
+
+	obj, info, err := oss.OpenFromOss(key)
+	if err != nil {
+		core.FailWithMessage("读取文件失败："+err.Error(), ctx)
+		return
+	}
+	defer obj.Close()
+	if info.ContentType != "" {
+		contentType = info.ContentType
+	}
+	ctx.Header("Content-Type", contentType)
+	ctx.Header("Cache-Control", "private, max-age=86400")
+	// 文件内容是别人发来的，不能让浏览器猜测类型，也不能在当前域名下直接打开网页之类的文件
+	ctx.Header("X-Content-Type-Options", "nosniff")
+	if doc.App != nil && doc.App.File != nil && key == doc.Media.Key {
+		// 文件消息下载的时候使用原始文件名
+		ctx.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": doc.App.File.Name}))
+	} else if !mediaInline(contentType) {
+		ctx.Header("Content-Disposition", "attachment")
+	}
+	http.ServeContent(ctx.Writer, ctx.Request, "", info.LastModified, obj)
+}
+
+// 是否可以在浏览器里直接打开，只有图片、视频和语音可以，SVG里面可以带脚本也要下载
+func mediaInline(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil || mediaType == "image/svg+xml" {
+		return false
+	}
+	return strings.HasPrefix(mediaType, "image/") || strings.HasPrefix(mediaType, "video/") || strings.HasPrefix(mediaType, "audio/")
+}
+
+// GetMediaRetentionReportHandle 预览当前登录用户按保留策略会被清理的媒体文件，不会删除任何文件
+func GetMediaRetentionReportHandle(ctx *gin.Context) {
+	// 获取AppKey
+	appKey := ctx.Request.Header.Get("AppKey")
+	self, err := global.GetBot(appKey).GetCurrentUser()
+	if err != nil {
+		core.FailWithMessage("获取登录用户信息失败", ctx)
+		return
+	}
+	report, err := handler.MediaRetentionDryRun(self.Uin)
+	if err != nil {
+		core.FailWithMessage("生成清理报告失败："+err.Error(), ctx)
+		return
+	}
+	core.OkWithData(report, ctx)
+}
@@ -1,9 +1,19 @@
 package controller
 
 import (
+	"errors"
+	"github.com/eatmoreapple/openwechat"
 	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"regexp"
+	"time"
 	"web-wechat/core"
+	. "web-wechat/db"
+	"web-wechat/event"
 	"web-wechat/global"
+	"web-wechat/handler"
 )
 
 // 发送消息请求体
@@ -16,6 +26,43 @@ type sendMsgRes struct {
 	Content string `form:"content" json:"content"`
 }
 
+// 历史消息查询参数
+type messageHistoryRes struct {
+	// 私聊联系人，ID、昵称或者备注
+	Contact string `form:"contact"`
+	// 群组，ID或者名称
+	Group string `form:"group"`
+	// 发信人，ID、昵称或者备注
+	Sender string `form:"sender"`
+	// 消息类型
+	Type int `form:"type"`
+	// 开始时间，格式为2006-01-02或者2006-01-02 15:04:05
+	Start string `form:"start"`
+	// 结束时间，格式同开始时间
+	End string `form:"end"`
+	// 内容关键字
+	Keyword string `form:"keyword"`
+	// 分页游标，传上一页返回的next_cursor
+	Cursor string `form:"cursor"`
+	// 排序方式: desc-从新到旧(默认) asc-从旧到新
+	Sort string `form:"sort"`
+	// 每页数量，默认20，最大100
+	Limit int64 `form:"limit"`
+}
+
+// 历史消息分页返回结构
+type messageHistoryResponse struct {
+	List       []handler.MessageDocument `json:"list"`
+	NextCursor string                    `json:"next_cursor"`
+	HasMore    bool                      `json:"has_more"`
+}
+
+// 消息时间格式
+const messageDateTimeLayout = "2006-01-02 15:04:05"
+
+// 查询时间按东八区解析
+var messageTimeLocation = time.FixedZone("CST", 8*3600)
+
 // SendMessageToUser 向指定用户发消息
 func SendMessageToUser(ctx *gin.Context) {
 	// 取出请求参数
@@ -27,22 +74,9 @@ func SendMessageToUser(ctx *gin.Context) {
 	// 获取AppKey
 	appKey := ctx.Request.Header.Get("AppKey")
 
-	bot := global.GetBot(appKey)
-	// 获取登录用户
-	self, _ := bot.GetCurrentUser()
-	// 查找指定的好友
-	friends, _ := self.Friends(true)
-	// 查询指定好友
-	friendSearchResult := friends.SearchByUserName(1, res.To)
-	if friendSearchResult.Count() < 1 {
-		core.FailWithMessage("指定好友不存在", ctx)
-		return
-	}
-	// 取出好友
-	friend := friendSearchResult.First()
 	// 发送消息
-	if _, err := friend.SendText(res.Content); err != nil {
-		core.FailWithMessage("消息发送失败："+err.Error(), ctx)
+	if _, err := sendTextToUser(appKey, res.To, res.Content, apiOrigin(ctx)); err != nil {
+		core.FailWithMessage(err.Error(), ctx)
 		return
 	}
 	core.Ok(ctx)
@@ -59,27 +93,190 @@ func SendMessageToGroup(ctx *gin.Context) {
 	// 获取AppKey
 	appKey := ctx.Request.Header.Get("AppKey")
 
+	// 发送消息
+	if _, err := sendTextToGroup(appKey, res.To, res.Content, apiOrigin(ctx)); err != nil {
+		core.FailWithMessage(err.Error(), ctx)
+		return
+	}
+	core.Ok(ctx)
+}
+
+// 接口发送消息的来源信息
+func apiOrigin(ctx *gin.Context) event.Origin {
+	return event.Origin{Source: event.SourceApi, Name: ctx.FullPath(), Trigger: ctx.ClientIP()}
+}
+
+// 向指定好友发送文本消息，发送结果会发布到事件总线
+func sendTextToUser(appKey, to, content string, origin event.Origin) (*openwechat.SentMessage, error) {
+	bot := global.GetBot(appKey)
+	// 获取登录用户
+	self, _ := bot.GetCurrentUser()
+	// 查找指定的好友
+	friends, _ := self.Friends(true)
+	// 查询指定好友
+	friendSearchResult := friends.SearchByUserName(1, to)
+	if friendSearchResult.Count() < 1 {
+		return nil, errors.New("指定好友不存在")
+	}
+	// 取出好友
+	friend := friendSearchResult.First()
+	// 发送消息
+	sent, err := friend.SendText(content)
+	event.PublishSent(appKey, friend.User, content, sent, err, origin)
+	if err != nil {
+		return nil, errors.New("消息发送失败：" + err.Error())
+	}
+	return sent, nil
+}
+
+// 向指定群组发送文本消息，发送结果会发布到事件总线
+func sendTextToGroup(appKey, to, content string, origin event.Origin) (*openwechat.SentMessage, error) {
 	bot := global.GetBot(appKey)
 	// 获取登录用户
 	self, _ := bot.GetCurrentUser()
 	// 获取所有群组
 	groups, err := self.Groups(true)
 	if err != nil {
-		core.FailWithMessage("群组获取失败", ctx)
-		return
+		return nil, errors.New("群组获取失败")
 	}
 	// 判断指定群组是否存在
-	search := groups.SearchByUserName(1, res.To)
+	search := groups.SearchByUserName(1, to)
 	if search.Count() < 1 {
-		core.FailWithMessage("指定群组不存在", ctx)
-		return
+		return nil, errors.New("指定群组不存在")
 	}
 	// 取出指定群组
 	group := search.First()
 	// 发送消息
-	if _, err := group.SendText(res.Content); err != nil {
-		core.FailWithMessage("消息发送失败："+err.Error(), ctx)
+	sent, err := group.SendText(content)
+	event.PublishSent(appKey, group.User, content, sent, err, origin)
+	if err != nil {
+		return nil, errors.New("消息发送失败：" + err.Error())
+	}
+	return sent, nil
+}
+
+// GetMessageHistoryHandle 查询历史消息
+func GetMessageHistoryHandle(ctx *gin.Context) {
+	var res messageHistoryRes
+	if err := ctx.ShouldBindQuery(&res); err != nil {
+		core.FailWithMessage("参数获取失败", ctx)
 		return
 	}
-	core.Ok(ctx)
+	if res.Limit <= 0 {
+		res.Limit = 20
+	}
+	if res.Limit > 100 {
+		res.Limit = 100
+	}
+	// 获取AppKey
+	appKey := ctx.Request.Header.Get("AppKey")
+	self, err := global.GetBot(appKey).GetCurrentUser()
+	if err != nil {
+		core.FailWithMessage("获取登录用户信息失败", ctx)
+		return
+	}
+
+	// 组装查询条件，只能查询当前登录用户的消息
+	filter := bson.M{"uin": self.Uin}
+	var conditions []bson.M
+	if res.Contact != "" {
+		filter["group"] = bson.M{"$exists": false}
+		conditions = append(conditions, messageUserFilter("chat", res.Contact))
+	}
+	if res.Group != "" {
+		conditions = append(conditions, messageUserFilter("group", res.Group))
+	}
+	if res.Sender != "" {
+		conditions = append(conditions, messageUserFilter("sender", res.Sender))
+	}
+	if len(conditions) > 0 {
+		filter["$and"] = conditions
+	}
+	if res.Type > 0 {
+		filter["msgType"] = res.Type
+	}
+	if res.Keyword != "" {
+		filter["content"] = primitive.Regex{Pattern: regexp.QuoteMeta(res.Keyword), Options: "i"}
+	}
+	createTime := bson.M{}
+	if res.Start != "" {
+		start, ok := parseMessageDateTime(res.Start, false)
+		if !ok {
+			core.FailWithMessage("开始时间格式错误", ctx)
+			return
+		}
+		createTime["$gte"] = start
+	}
+	if res.End != "" {
+		end, ok := parseMessageDateTime(res.End, true)
+		if !ok {
+			core.FailWithMessage("结束时间格式错误", ctx)
+			return
+		}
+		createTime["$lte"] = end
+	}
+	if len(createTime) > 0 {
+		filter["createTime"] = createTime
+	}
+
+	// 按_id游标分页
+	sort := -1
+	cursorOp := "$lt"
+	if res.Sort == "asc" {
+		sort = 1
+		cursorOp = "$gt"
+	}
+	if res.Cursor != "" {
+		cursor, err := primitive.ObjectIDFromHex(res.Cursor)
+		if err != nil {
+			core.FailWithMessage("分页游标错误", ctx)
+			return
+		}
+		filter["_id"] = bson.M{cursorOp: cursor}
+	}
+
+	// 多查一条用来判断是否还有下一页
+	opts := options.Find().SetSort(bson.D{{Key: "_id", Value: sort}}).SetLimit(res.Limit + 1)
+	var list []handler.MessageDocument
+	if err = MongoClient.Find(filter, opts, handler.MessageTableName, &list); err != nil {
+		core.FailWithMessage("查询历史消息失败："+err.Error(), ctx)
+		return
+	}
+	for i := range list {
+		list[i].RefreshMediaUrl()
+	}
+	resp := messageHistoryResponse{List: list}
+	if int64(len(list)) > res.Limit {
+		resp.List = list[:res.Limit]
+		resp.HasMore = true
+		resp.NextCursor = resp.List[len(resp.List)-1].Id.Hex()
+	}
+	if resp.List == nil {
+		resp.List = []handler.MessageDocument{}
+	}
+	core.OkWithData(resp, ctx)
+}
+
+// 按ID、昵称或者备注匹配消息里的用户
+func messageUserFilter(field, value string) bson.M {
+	return bson.M{"$or": []bson.M{
+		{field + ".id": value},
+		{field + ".nickName": value},
+		{field + ".remarkName": value},
+	}}
+}
+
+// 解析查询时间，只传了日期的时候，结束时间取当天最后一秒
+func parseMessageDateTime(value string, isEnd bool) (time.Time, bool) {
+	if t, err := time.ParseInLocation(messageDateTimeLayout, value, messageTimeLocation); err == nil {
+		return t, true
+	}
+	t, err := time.ParseInLocation("2006-01-02", value, messageTimeLocation)
+	if err != nil {
+		return t, false
+	}
+	if isEnd {
+		t = t.Add(24*time.Hour - time.Second)
+	}
+	return t, true
 }
@@ -1,11 +1,24 @@
 package controller
 
 import (
+	"bytes"
+	"crypto/md5"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
 	"gitee.ltd/lxh/logger/log"
 	"github.com/eatmoreapple/openwechat"
 	"github.com/gin-gonic/gin"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
 	"web-wechat/core"
+	. "web-wechat/db"
 	"web-wechat/global"
+	"web-wechat/oss"
+	"web-wechat/utils"
 )
 
 // 返回用户信息包装类
@@ -30,6 +43,43 @@ type friendsResponse struct {
 	Groups  []responseUserInfo `json:"groups"`
 }
 
+// 导出的联系人信息
+type contactExportRow struct {
+	Type        string   `json:"type"`         // 类型: friend-好友 group-群组 member-群成员
+	Id          string   `json:"id"`           // 唯一ID，多次登录不会变化
+	GroupId     string   `json:"group_id"`     // 所属群组唯一ID(群成员独有)
+	GroupName   string   `json:"group_name"`   // 所属群组名称(群成员独有)
+	Uin         int64    `json:"uin"`          // 用户唯一ID
+	Sex         int      `json:"sex"`          // 性别
+	Province    string   `json:"province"`     // 省
+	City        string   `json:"city"`         // 市
+	Alias       string   `json:"alias"`        // 别名
+	DisplayName string   `json:"display_name"` // 显示名称
+	NickName    string   `json:"nick_name"`    // 昵称
+	RemarkName  string   `json:"remark_name"`  // 备注
+	HeadImgUrl  string   `json:"head_img_url"` // 头像
+	UserName    string   `json:"user_name"`    // 当前登录中用户的唯一标识
+	Flags       []string `json:"flags"`        // 联系人属性，比如星标、置顶，网页版协议获取不到微信里设置的标签
+}
+
+// 导出文件的表头，顺序和contactExportRow.toRecord保持一致
+var contactExportHeader = []string{"type", "id", "group_id", "group_name", "uin", "sex", "province", "city",
+	"alias", "display_name", "nick_name", "remark_name", "head_img_url", "user_name", "flags"}
+
+// 转换为表格的一行
+func (r contactExportRow) toRecord() []string {
+	return []string{r.Type, r.Id, r.GroupId, r.GroupName, strconv.FormatInt(r.Uin, 10), strconv.Itoa(r.Sex),
+		r.Province, r.City, r.Alias, r.DisplayName, r.NickName, r.RemarkName, r.HeadImgUrl, r.UserName,
+		strings.Join(r.Flags, ",")}
+}
+
+// 头像缓存信息
+type avatarCache struct {
+	ETag        string `json:"etag"`         // 头像内容摘要
+	ContentType string `json:"content_type"` // 文件类型
+	FileName    string `json:"file_name"`    // OSS文件名
+}
+
 // GetCurrentUserInfoHandle 获取当前登录用户
 func GetCurrentUserInfoHandle(ctx *gin.Context) {
 	// 获取AppKey
@@ -118,3 +168,234 @@ func GetFriendsListHandle(ctx *gin.Context) {
 	// 返回给前端
 	core.OkWithData(friendsResponse{Count: friends.Count(), Friends: friendList, Groups: groupList}, ctx)
 }
+
+// GetUserAvatarHandle 获取联系人头像
+// id可以是UserName或者唯一ID，群成员需要通过group参数传入群组的UserName
+func GetUserAvatarHandle(ctx *gin.Context) {
+	// 获取AppKey
+	appKey := ctx.Request.Header.Get("AppKey")
+
+	bot := global.GetBot(appKey)
+	self, err := bot.GetCurrentUser()
+	if err != nil {
+		core.FailWithMessage("获取登录用户信息失败", ctx)
+		return
+	}
+	user := searchUser(self, ctx.Param("id"), ctx.Query("group"))
+	if user == nil {
+		core.FailWithMessage("指定用户不存在", ctx)
+		return
+	}
+
+	// 头像缓存Key使用唯一ID，避免重新登录之后UserName变化导致缓存失效
+	userId := utils.GetUserId(user)
+	cacheKey := fmt.Sprintf("wechat:avatar:%v:%v", self.Uin, userId)
+	if data, err := RedisClient.GetData(cacheKey); err == nil {
+		var cache avatarCache
+		if err = json.Unmarshal([]byte(data), &cache); err == nil {
+			if ctx.GetHeader("If-None-Match") == cache.ETag {
+				setAvatarHeader(ctx, cache.ETag)
+				ctx.Status(http.StatusNotModified)
+				return
+			}
+			if obj, err := oss.GetFromOss(cache.FileName); err == nil {
+				defer obj.Close()
+				setAvatarHeader(ctx, cache.ETag)
+				ctx.DataFromReader(http.StatusOK, -1, cache.ContentType, obj, nil)
+				return
+			}
+			log.Debugf("头像缓存文件读取失败，重新下载: %v", cache.FileName)
+		}
+	}
+
+	// 通过Bot的登录会话下载头像
+	resp, err := user.GetAvatarResponse()
+	if err != nil {
+		log.Errorf("头像下载失败: %v", err.Error())
+		core.FailWithMessage("头像下载失败："+err.Error(), ctx)
+		return
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil || len(body) == 0 {
+		log.Errorf("头像读取失败: %v", err)
+		core.FailWithMessage("头像读取失败", ctx)
+		return
+	}
+	contentType := http.DetectContentType(body)
+	etag := fmt.Sprintf("\"%x\"", md5.Sum(body))
+
+	// 保存到OSS并记录缓存信息
+	fileName := fmt.Sprintf("avatar/%v/%v", self.Uin, userId)
+	if oss.SaveToOss(bytes.NewReader(body), int64(len(body)), contentType, fileName) {
+		cache, _ := json.Marshal(avatarCache{ETag: etag, ContentType: contentType, FileName: fileName})
+		if err = RedisClient.SetWithTimeout(cacheKey, string(cache), 24*time.Hour); err != nil {
+			log.Errorf("头像缓存信息保存失败: %v", err.Error())
+		}
+	}
+
+	setAvatarHeader(ctx, etag)
+	if ctx.GetHeader("If-None-Match") == etag {
+		ctx.Status(http.StatusNotModified)
+		return
+	}
+	ctx.Data(http.StatusOK, contentType, body)
+}
+
+// 设置头像缓存相关的响应头
+func setAvatarHeader(ctx *gin.Context, etag string) {
+	ctx.Header("ETag", etag)
+	ctx.Header("Cache-Control", "private, max-age=3600")
+}
+
+// 根据UserName或者唯一ID查找联系人，传入群组时从群成员里查找
+func searchUser(self *openwechat.Self, id, group string) *openwechat.User {
+	match := func(user *openwechat.User) bool {
+		return user.UserName == id || user.ID() == id
+	}
+	if match(self.User) {
+		return self.User
+	}
+	members, err := self.Members()
+	if err != nil {
+		log.Errorf("获取联系人列表失败: %v", err.Error())
+		return nil
+	}
+	if group != "" {
+		user, exist := members.GetByUserName(group)
+		if !exist {
+			return nil
+		}
+		g, ok := user.AsGroup()
+		if !ok {
+			return nil
+		}
+		if members, err = g.Members(); err != nil {
+			log.Errorf("获取群成员失败: %v", err.Error())
+			return nil
+		}
+	}
+	return members.Search(1, match).First()
+}
+
+// ExportContactsHandle 导出好友、群组以及群成员
+func ExportContactsHandle(ctx *gin.Context) {
+	format := ctx.DefaultQuery("format", "json")
+	if format != "json" && format != "csv" && format != "xlsx" {
+		core.FailWithMessage("不支持的导出格式", ctx)
+		return
+	}
+	// 获取AppKey
+	appKey := ctx.Request.Header.Get("AppKey")
+
+	bot := global.GetBot(appKey)
+	user, err := bot.GetCurrentUser()
+	if err != nil {
+		core.FailWithMessage("获取登录用户信息失败", ctx)
+		return
+	}
+	friends, err := user.Friends(true)
+	if err != nil {
+		core.FailWithMessage("获取好友列表失败", ctx)
+		return
+	}
+	groups, err := user.Groups(true)
+	if err != nil {
+		core.FailWithMessage("获取群聊列表失败", ctx)
+		return
+	}
+
+	// 组装数据
+	var rows []contactExportRow
+	for _, friend := range friends {
+		rows = append(rows, newContactExportRow("friend", friend.User, nil))
+	}
+	for _, group := range groups {
+		rows = append(rows, newContactExportRow("group", group.User, nil))
+		members, err := group.Members()
+		if err != nil {
+			log.Errorf("[%v]获取群成员失败: %v", group.NickName, err.Error())
+			continue
+		}
+		for _, member := range members {
+			rows = append(rows, newContactExportRow("member", member, group.User))
+		}
+	}
+
+	// 生成导出文件
+	var buf bytes.Buffer
+	contentType := "application/json; charset=utf-8"
+	switch format {
+	case "json":
+		err = json.NewEncoder(&buf).Encode(rows)
+	case "csv":
+		contentType = "text/csv; charset=utf-8"
+		// 写入BOM，避免Excel打开中文乱码
+		buf.WriteString("\xEF\xBB\xBF")
+		w := csv.NewWriter(&buf)
+		_ = w.Write(contactExportHeader)
+		for _, row := range rows {
+			_ = w.Write(row.toRecord())
+		}
+		w.Flush()
+		err = w.Error()
+	case "xlsx":
+		contentType = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+		records := [][]string{contactExportHeader}
+		for _, row := range rows {
+			records = append(records, row.toRecord())
+		}
+		err = utils.WriteXlsx(&buf, "contacts", records)
+	}
+	if err != nil {
+		log.Errorf("生成导出文件失败: %v", err.Error())
+		core.FailWithMessage("生成导出文件失败", ctx)
+		return
+	}
+
+	fileName := fmt.Sprintf("contacts_%v_%v.%v", user.Uin, time.Now().Format("20060102150405"), format)
+	ctx.Header("Content-Disposition", "attachment; filename="+fileName)
+	ctx.Data(http.StatusOK, contentType, buf.Bytes())
+}
+
+// 组装导出的联系人信息
+func newContactExportRow(tp string, user *openwechat.User, group *openwechat.User) contactExportRow {
+	row := contactExportRow{
+		Type:        tp,
+		Id:          utils.GetUserId(user),
+		Uin:         user.Uin,
+		Sex:         user.Sex,
+		Province:    user.Province,
+		City:        user.City,
+		Alias:       user.Alias,
+		DisplayName: user.DisplayName,
+		NickName:    user.NickName,
+		RemarkName:  user.RemarkName,
+		HeadImgUrl:  user.HeadImgUrl,
+		UserName:    user.UserName,
+		Flags:       contactFlags(user),
+	}
+	if group != nil {
+		row.GroupId = utils.GetUserId(group)
+		row.GroupName = group.NickName
+	}
+	return row
+}
+
+// 联系人属性，网页版协议获取不到微信里设置的标签，只能导出这些属性
+func contactFlags(user *openwechat.User) []string {
+	flags := make([]string, 0)
+	if user.StarFriend == 1 {
+		flags = append(flags, "星标")
+	}
+	if user.IsPin() {
+		flags = append(flags, "置顶")
+	}
+	if user.IsMP() {
+		flags = append(flags, "公众号")
+	}
+	if user.IsGroup() && user.IsOwner == 1 {
+		flags = append(flags, "群主")
+	}
+	return flags
+}
@@ -0,0 +1,67 @@
+package controller
+
+import (
+	"github.com/gin-gonic/gin"
+	"net/url"
+	"web-wechat/core"
+	"web-wechat/webhook"
+)
+
+// Webhook配置请求体
+type webhookConfigRes struct {
+	// 推送地址
+	Url string `form:"url" json:"url"`
+	// 签名密钥
+	Secret string `form:"secret" json:"secret"`
+}
+
+// 返回的Webhook配置，不返回密钥
+type webhookConfigResponse struct {
+	Url       string `json:"url"`
+	HasSecret bool   `json:"has_secret"`
+}
+
+// GetWebhookConfigHandle 获取Webhook配置
+func GetWebhookConfigHandle(ctx *gin.Context) {
+	appKey := ctx.Request.Header.Get("AppKey")
+	conf, err := webhook.GetConfig(appKey)
+	if err != nil {
+		core.FailWithMessage("获取Webhook配置失败："+err.Error(), ctx)
+		return
+	}
+	if conf == nil {
+		core.FailWithMessage("未配置Webhook", ctx)
+		return
+	}
+	core.OkWithData(webhookConfigResponse{Url: conf.Url, HasSecret: conf.Secret != ""}, ctx)
+}
+
+// SaveWebhookConfigHandle 保存Webhook配置
+func SaveWebhookConfigHandle(ctx *gin.Context) {
+	var res webhookConfigRes
+	if err := ctx.ShouldBindJSON(&res); err != nil {
+		core.FailWithMessage("参数获取失败", ctx)
+		return
+	}
+	u, err := url.ParseRequestURI(res.Url)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		core.FailWithMessage("推送地址格式错误", ctx)
+		return
+	}
+	appKey := ctx.Request.Header.Get("AppKey")
+	if err = webhook.SaveConfig(appKey, webhook.Config{Url: res.Url, Secret: res.Secret}); err != nil {
+		core.FailWithMessage("保存Webhook配置失败："+err.Error(), ctx)
+		return
+	}
+	core.Ok(ctx)
+}
+
+// DeleteWebhookConfigHandle 删除Webhook配置
+func DeleteWebhookConfigHandle(ctx *gin.Context) {
+	appKey := ctx.Request.Header.Get("AppKey")
+	if err := webhook.DeleteConfig(appKey); err != nil {
+		core.FailWithMessage("删除Webhook配置失败："+err.Error(), ctx)
+		return
+	}
+	core.Ok(ctx)
+}
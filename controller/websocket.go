@@ -0,0 +1,106 @@
+package controller
+
+import (
+	"gitee.ltd/lxh/logger/log"
+	"github.com/eatmoreapple/openwechat"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"web-wechat/core"
+	"web-wechat/event"
+	"web-wechat/global"
+	"web-wechat/stream"
+)
+
+// WebSocket升级配置，接口通过AppKey鉴权，网页来源按配置限制
+var upgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+	// 通过子协议传入AppKey的时候需要返回子协议，否则浏览器会断开连接
+	Subprotocols: []string{stream.AppKeyProtocol},
+	CheckOrigin:  stream.CheckOrigin,
+}
+
+// WebSocket客户端发来的指令
+type wsCommand struct {
+	// 指令类型，目前只支持send
+	Action string `json:"action"`
+	// 请求ID，原样返回给客户端
+	RequestId string `json:"request_id"`
+	// 发送对象类型: user-好友 group-群组
+	Target string `json:"target"`
+	sendMsgRes
+}
+
+// 指令处理结果
+type wsCommandResult struct {
+	Event     string      `json:"event"`
+	RequestId string      `json:"request_id"`
+	Code      int         `json:"code"`
+	Data      interface{} `json:"data"`
+	Msg       string      `json:"msg"`
+}
+
+// 发送消息的结果
+type wsSendResult struct {
+	MsgId string `json:"msg_id"`
+}
+
+// MessageWebSocketHandle 实时推送收发的消息，并支持通过连接发送消息
+func MessageWebSocketHandle(ctx *gin.Context) {
+	appKey := ctx.Request.Header.Get("AppKey")
+	conn, err := upgrader.Upgrade(ctx.Writer, ctx.Request, nil)
+	if err != nil {
+		log.Errorf("[%v]WebSocket连接升级失败: %v", appKey, err.Error())
+		return
+	}
+	client := stream.Register(appKey, conn)
+	defer client.Close()
+	log.Infof("[%v]WebSocket已连接", appKey)
+
+	// 读取客户端指令，连接断开或者出错退出
+	for {
+		var cmd wsCommand
+		if err = conn.ReadJSON(&cmd); err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseNormalClosure) {
+				log.Errorf("[%v]WebSocket读取失败: %v", appKey, err.Error())
+			}
+			break
+		}
+		client.SendJSON(handleWsCommand(appKey, ctx.ClientIP(), cmd))
+	}
+	log.Infof("[%v]WebSocket已断开", appKey)
+}
+
+// 处理客户端指令，clientIP记录为消息的触发者
+func handleWsCommand(appKey, clientIP string, cmd wsCommand) wsCommandResult {
+	result := wsCommandResult{Event: "ack", RequestId: cmd.RequestId, Code: core.ERROR, Data: map[string]interface{}{}}
+	if cmd.Action != "send" {
+		result.Msg = "不支持的指令"
+		return result
+	}
+	// 发送前再检查一次登录状态，连接期间可能已经掉线
+	if err := global.CheckBot(appKey); err != nil {
+		result.Msg = "AppKey预检失败：" + err.Error()
+		return result
+	}
+	var sent *openwechat.SentMessage
+	var err error
+	origin := event.Origin{Source: event.SourceWebSocket, Name: cmd.Action, Trigger: clientIP}
+	switch cmd.Target {
+	case "user":
+		sent, err = sendTextToUser(appKey, cmd.To, cmd.Content, origin)
+	case "group":
+		sent, err = sendTextToGroup(appKey, cmd.To, cmd.Content, origin)
+	default:
+		result.Msg = "不支持的发送对象类型"
+		return result
+	}
+	if err != nil {
+		result.Msg = err.Error()
+		return result
+	}
+	result.Code = core.SUCCESS
+	result.Data = wsSendResult{MsgId: sent.MsgId}
+	result.Msg = "操作成功"
+	return result
+}
@@ -9,11 +9,17 @@ var SystemConfig systemConfig
 
 // 系统配置
 type systemConfig struct {
-	RedisConfig   redisConfig  `mapstructure:"redis"`
-	MySQLConfig   mysqlConfig  `mapstructure:"mysql"`
-	OssConfig     ossConfig    `mapstructure:"oss"`
-	MongoDbConfig mongoConfig  `mapstructure:"mongodb"`
-	OpenAiConfig  openAiConfig `mapstructure:"openai"`
+	RedisConfig   redisConfig   `mapstructure:"redis"`
+	MySQLConfig   mysqlConfig   `mapstructure:"mysql"`
+	OssConfig     ossConfig     `mapstructure:"oss"`
+	MongoDbConfig mongoConfig   `mapstructure:"mongodb"`
+	OpenAiConfig  openAiConfig  `mapstructure:"openai"`
+	WebhookConfig webhookConfig `mapstructure:"webhook"`
+	RecallConfig  recallConfig  `mapstructure:"recall"`
+	SpeechConfig  speechConfig  `mapstructure:"speech"`
+	MediaConfig   mediaConfig   `mapstructure:"media"`
+	PluginConfig  pluginConfig  `mapstructure:"plugin"`
+	WsConfig      wsConfig      `mapstructure:"websocket"`
 }
 
 // openAiConfig
@@ -24,6 +30,64 @@ type openAiConfig struct {
 	Proxy  string `mapstructure:"proxy"`  // 代理
 }
 
+// pluginConfig
+// @description: 插件配置
+type pluginConfig struct {
+	Prefix string            `mapstructure:"prefix"` // 指令前缀，比如/或者#，为空的时候不需要前缀；群里@机器人的时候可以不加前缀
+	Roles  map[string]string `mapstructure:"roles"`  // 插件需要的角色，member-所有人 admin-管理员 owner-登录的微信自己，不配置使用插件默认的角色
+}
+
+// webhookConfig
+// @description: Webhook推送配置，推送地址按AppKey单独配置
+type webhookConfig struct {
+	Timeout  int `mapstructure:"timeout"`  // 单次推送超时时间(秒)
+	MaxRetry int `mapstructure:"maxRetry"` // 推送失败最大重试次数
+}
+
+// wsConfig
+// @description: WebSocket配置
+type wsConfig struct {
+	AllowOrigins []string `mapstructure:"allowOrigins"` // 允许连接的网页来源，比如https://example.com，*为不限制，为空只允许同源
+}
+
+// recallConfig
+// @description: 防撤回配置
+type recallConfig struct {
+	Notify string `mapstructure:"notify"` // 撤回提醒发送到的会话，filehelper为文件传输助手，也可以填好友或群组的ID、备注、昵称，为空不提醒
+}
+
+// speechConfig
+// @description: 语音识别配置
+type speechConfig struct {
+	Provider string `mapstructure:"provider"` // 语音识别服务，为空不识别，static为返回固定内容的本地替身
+	Text     string `mapstructure:"text"`     // static返回的固定内容
+	Timeout  int    `mapstructure:"timeout"`  // 单次识别超时时间(秒)
+}
+
+// mediaConfig
+// @description: 消息媒体文件配置
+type mediaConfig struct {
+	MaxSize   map[string]int64     `mapstructure:"maxSize"`   // 各类型文件的大小限制(MB)，类型有image、emoticon、voice、video、file，不配置不限制
+	ThumbSize int                  `mapstructure:"thumbSize"` // 缩略图最长边(像素)，默认240
+	Retry     mediaRetryConfig     `mapstructure:"retry"`     // 下载失败重试配置
+	Retention mediaRetentionConfig `mapstructure:"retention"` // 文件保留配置
+	ProxyUrl  string               `mapstructure:"proxyUrl"`  // 本服务的访问地址，配置之后文件链接使用/media/消息ID接口，bucket不需要公开
+}
+
+// 媒体文件保留配置
+type mediaRetentionConfig struct {
+	Enable   bool                      `mapstructure:"enable"`   // 是否启用定时清理
+	Interval int                       `mapstructure:"interval"` // 清理间隔(小时)，默认24
+	Days     map[string]int            `mapstructure:"days"`     // 各类型文件保留天数，不配置或者为0永久保留
+	Accounts map[string]map[string]int `mapstructure:"accounts"` // 按登录用户Uin单独配置各类型的保留天数，覆盖默认配置
+}
+
+// 媒体文件下载失败重试配置
+type mediaRetryConfig struct {
+	Interval    int `mapstructure:"interval"`    // 重试间隔(秒)，每次失败后翻倍，默认60
+	MaxAttempts int `mapstructure:"maxAttempts"` // 最多重试次数，默认5
+}
+
 // Redis配置
 type redisConfig struct {
 	Host     string `mapstructure:"host"`     // Redis主机
@@ -42,11 +106,18 @@ type mysqlConfig struct {
 }
 
 type ossConfig struct {
+	Driver          string `mapstructure:"driver"`          // 存储方式: minio(默认)、local-本地文件、memory-内存
+	LocalPath       string `mapstructure:"localPath"`       // 本地文件存储的根目录
 	Endpoint        string `mapstructure:"endpoint"`        // 接口地址
 	AccessKeyID     string `mapstructure:"accessKeyId"`     // 账号
 	SecretAccessKey string `mapstructure:"accessKeySecret"` // 密码
 	BucketName      string `mapstructure:"bucket"`          // 桶名称
 	UseSsl          bool   `mapstructure:"ssl"`             // 是否使用SSL
+	PublicUrl       string `mapstructure:"publicUrl"`       // 文件访问地址前缀，比如CDN地址，配置了以后文件链接为 前缀/文件名
+	UrlStyle        string `mapstructure:"urlStyle"`        // MinIO链接格式: path(默认)-endpoint/bucket/文件名 virtual-bucket.endpoint/文件名
+	BucketLookup    string `mapstructure:"bucketLookup"`    // MinIO客户端访问桶的方式: auto(默认)、path、dns，只影响上传下载和临时链接，不影响urlStyle
+	Presign         bool   `mapstructure:"presign"`         // 私有桶生成有有效期的临时链接
+	PresignExpire   int    `mapstructure:"presignExpire"`   // 临时链接有效期(秒)，默认3600，最长7天
 }
 
 type mongoConfig struct {
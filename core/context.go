@@ -0,0 +1,20 @@
+package core
+
+import "context"
+
+// 保存AppKey用的Context Key
+type appKeyContextKey struct{}
+
+// ContextWithAppKey 把AppKey保存到Context，Bot创建的时候使用，消息处理的时候就能知道消息属于哪个AppKey
+func ContextWithAppKey(ctx context.Context, appKey string) context.Context {
+	return context.WithValue(ctx, appKeyContextKey{}, appKey)
+}
+
+// AppKeyFromContext 从Context取出AppKey
+func AppKeyFromContext(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	appKey, _ := ctx.Value(appKeyContextKey{}).(string)
+	return appKey
+}
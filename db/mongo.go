@@ -2,6 +2,7 @@ package db
 
 import (
 	"context"
+	"errors"
 	"gitee.ltd/lxh/logger/log"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
@@ -41,8 +42,7 @@ func (m *mongoDBClient) Save(data interface{}, tableName string) bool {
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel() // 在调用WithTimeout之后defer cancel()
 
-	collection := m.client.Database(core.SystemConfig.MongoDbConfig.DbName).Collection(tableName)
-	res, err := collection.InsertOne(ctx, data)
+	res, err := m.collection(tableName).InsertOne(ctx, data)
 	if err != nil {
 		log.Errorf("保存数据到MongoDB失败: %v", err.Error())
 		return false
@@ -50,3 +50,168 @@ func (m *mongoDBClient) Save(data interface{}, tableName string) bool {
 	log.Debugf("MongoDB保存结果: %v", res)
 	return true
 }
+
+// ReplaceOne 替换一条数据
+func (m *mongoDBClient) ReplaceOne(filter, data interface{}, tableName string) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel() // 在调用WithTimeout之后defer cancel()
+
+	if _, err := m.collection(tableName).ReplaceOne(ctx, filter, data); err != nil {
+		log.Errorf("MongoDB替换数据失败: %v", err.Error())
+		return false
+	}
+	return true
+}
+
+// Update 更新一条数据
+func (m *mongoDBClient) Update(filter, update interface{}, tableName string) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel() // 在调用WithTimeout之后defer cancel()
+
+	if _, err := m.collection(tableName).UpdateOne(ctx, filter, update); err != nil {
+		log.Errorf("MongoDB更新数据失败: %v", err.Error())
+		return false
+	}
+	return true
+}
+
+// Upsert 更新一条数据，不存在的时候插入
+func (m *mongoDBClient) Upsert(filter, update interface{}, tableName string) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel() // 在调用WithTimeout之后defer cancel()
+
+	if _, err := m.collection(tableName).UpdateOne(ctx, filter, update, options.Update().SetUpsert(true)); err != nil {
+		log.Errorf("MongoDB更新数据失败: %v", err.Error())
+		return false
+	}
+	return true
+}
+
+// UpdateCount 更新一条数据，返回匹配到的数量，用来判断条件更新是否成功
+func (m *mongoDBClient) UpdateCount(filter, update interface{}, tableName string) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel() // 在调用WithTimeout之后defer cancel()
+
+	res, err := m.collection(tableName).UpdateOne(ctx, filter, update)
+	if err != nil {
+		log.Errorf("MongoDB更新数据失败: %v", err.Error())
+		return 0, err
+	}
+	return res.MatchedCount, nil
+}
+
+// UpsertCount 更新一条数据，不存在的时候插入，返回插入的数量
+func (m *mongoDBClient) UpsertCount(filter, update interface{}, tableName string) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel() // 在调用WithTimeout之后defer cancel()
+
+	res, err := m.collection(tableName).UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+	if err != nil {
+		log.Errorf("MongoDB更新数据失败: %v", err.Error())
+		return 0, err
+	}
+	return res.UpsertedCount, nil
+}
+
+// FindOneAndUpdate 更新一条数据，更新前的数据解析到result，没有匹配的数据时返回mongo.ErrNoDocuments
+func (m *mongoDBClient) FindOneAndUpdate(filter, update interface{}, tableName string, result interface{}) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel() // 在调用WithTimeout之后defer cancel()
+
+	return m.collection(tableName).FindOneAndUpdate(ctx, filter, update).Decode(result)
+}
+
+// DeleteOne 删除一条数据，返回删除的数量
+func (m *mongoDBClient) DeleteOne(filter interface{}, tableName string) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel() // 在调用WithTimeout之后defer cancel()
+
+	res, err := m.collection(tableName).DeleteOne(ctx, filter)
+	if err != nil {
+		log.Errorf("MongoDB删除数据失败: %v", err.Error())
+		return 0, err
+	}
+	return res.DeletedCount, nil
+}
+
+// Count 统计符合条件的数据数量
+func (m *mongoDBClient) Count(filter interface{}, tableName string) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel() // 在调用WithTimeout之后defer cancel()
+
+	return m.collection(tableName).CountDocuments(ctx, filter)
+}
+
+// Delete 删除符合条件的数据
+func (m *mongoDBClient) Delete(filter interface{}, tableName string) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel() // 在调用WithTimeout之后defer cancel()
+
+	if _, err := m.collection(tableName).DeleteMany(ctx, filter); err != nil {
+		log.Errorf("MongoDB删除数据失败: %v", err.Error())
+		return false
+	}
+	return true
+}
+
+// Find 查询数据，结果解析到results(切片指针)
+func (m *mongoDBClient) Find(filter interface{}, opts *options.FindOptions, tableName string, results interface{}) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel() // 在调用WithTimeout之后defer cancel()
+
+	cursor, err := m.collection(tableName).Find(ctx, filter, opts)
+	if err != nil {
+		log.Errorf("MongoDB查询数据失败: %v", err.Error())
+		return err
+	}
+	return cursor.All(ctx, results)
+}
+
+// CreateIndexes 创建索引，索引已存在时不会重复创建
+func (m *mongoDBClient) CreateIndexes(tableName string, models []mongo.IndexModel) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel() // 在调用WithTimeout之后defer cancel()
+
+	names, err := m.collection(tableName).Indexes().CreateMany(ctx, models)
+	if err != nil {
+		log.Errorf("MongoDB创建索引失败: %v", err.Error())
+		return err
+	}
+	log.Debugf("MongoDB索引创建结果: %v", names)
+	return nil
+}
+
+// Aggregate 聚合查询，结果解析到results(切片指针)
+func (m *mongoDBClient) Aggregate(pipeline interface{}, tableName string, results interface{}) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel() // 在调用WithTimeout之后defer cancel()
+
+	cursor, err := m.collection(tableName).Aggregate(ctx, pipeline, options.Aggregate().SetAllowDiskUse(true))
+	if err != nil {
+		log.Errorf("MongoDB聚合查询失败: %v", err.Error())
+		return err
+	}
+	return cursor.All(ctx, results)
+}
+
+// DropIndex 删除索引，索引不存在时不报错
+func (m *mongoDBClient) DropIndex(tableName, name string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel() // 在调用WithTimeout之后defer cancel()
+
+	if _, err := m.collection(tableName).Indexes().DropOne(ctx, name); err != nil {
+		var cmdErr mongo.CommandError
+		// 27: IndexNotFound
+		if errors.As(err, &cmdErr) && cmdErr.Code == 27 {
+			return nil
+		}
+		log.Errorf("MongoDB删除索引失败: %v", err.Error())
+		return err
+	}
+	return nil
+}
+
+// 获取表对象
+func (m *mongoDBClient) collection(tableName string) *mongo.Collection {
+	return m.client.Database(core.SystemConfig.MongoDbConfig.DbName).Collection(tableName)
+}
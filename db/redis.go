@@ -31,6 +31,11 @@ func InitRedisConnHandle() {
 	RedisClient = redisConn{client: conn}
 }
 
+// IsRedisNil 判断是不是Key不存在的错误
+func IsRedisNil(err error) bool {
+	return err == redis.Nil
+}
+
 // GetData 获取数据
 func (r *redisConn) GetData(key string) (string, error) {
 	return r.client.Get(context.Background(), key).Result()
@@ -55,3 +60,18 @@ func (r *redisConn) SetWithTimeout(key string, value string, timeout time.Durati
 func (r *redisConn) Del(key string) error {
 	return r.client.Del(context.Background(), key).Err()
 }
+
+// HGetAll 获取Hash的所有字段
+func (r *redisConn) HGetAll(key string) (map[string]string, error) {
+	return r.client.HGetAll(context.Background(), key).Result()
+}
+
+// HSet 设置Hash的字段
+func (r *redisConn) HSet(key, field, value string) error {
+	return r.client.HSet(context.Background(), key, field, value).Err()
+}
+
+// HDel 删除Hash的字段
+func (r *redisConn) HDel(key string, fields ...string) error {
+	return r.client.HDel(context.Background(), key, fields...).Err()
+}
@@ -0,0 +1,47 @@
+package event
+
+import (
+	"sync"
+	"time"
+)
+
+// 事件类型
+const (
+	MessageReceived = "message.received" // 收到新消息
+	MessageSent     = "message.sent"     // 发出消息
+	MessageSendFail = "message.failed"   // 消息发送失败
+	MessageRecalled = "message.recalled" // 消息被撤回
+)
+
+// Event 事件
+type Event struct {
+	Type      string      `json:"event"`     // 事件类型
+	AppKey    string      `json:"app_key"`   // 事件所属的AppKey
+	Timestamp int64       `json:"timestamp"` // 事件发生时间戳(秒)
+	Data      interface{} `json:"data"`      // 事件数据
+}
+
+// Handler 事件处理函数
+type Handler func(e Event)
+
+var (
+	handlers []Handler
+	mu       sync.RWMutex
+)
+
+// Subscribe 订阅事件
+func Subscribe(handler Handler) {
+	mu.Lock()
+	defer mu.Unlock()
+	handlers = append(handlers, handler)
+}
+
+// Publish 发布事件，订阅者是同步调用的，耗时的处理需要订阅者自己异步执行
+func Publish(appKey, eventType string, data interface{}) {
+	e := Event{Type: eventType, AppKey: appKey, Timestamp: time.Now().Unix(), Data: data}
+	mu.RLock()
+	defer mu.RUnlock()
+	for _, handler := range handlers {
+		handler(e)
+	}
+}
@@ -0,0 +1,48 @@
+package event
+
+import (
+	"github.com/eatmoreapple/openwechat"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+// 群事件类型
+const (
+	GroupMemberJoined  = "group.member_joined"  // 有人加入群聊
+	GroupMemberRemoved = "group.member_removed" // 有人被移出群聊
+	GroupRenamed       = "group.renamed"        // 群聊改名
+	GroupOwnerChanged  = "group.owner_changed"  // 群主变更
+)
+
+// 消息上下文里保存群事件用的Key
+const groupEventContextKey = "groupEvent"
+
+// GroupEvent 群成员变动等群事件，由群系统通知解析而来
+type GroupEvent struct {
+	Id         primitive.ObjectID `json:"-" bson:"_id,omitempty"`
+	Uin        int64              `json:"uin" bson:"uin"`                               // 事件所属的登录用户
+	Type       string             `json:"type" bson:"type"`                             // 事件类型
+	Group      *User              `json:"group" bson:"group"`                           // 群组
+	Operator   string             `json:"operator,omitempty" bson:"operator,omitempty"` // 操作人昵称，比如移出成员、修改群名的人
+	Inviter    string             `json:"inviter,omitempty" bson:"inviter,omitempty"`   // 邀请人昵称，扫码加群时为分享二维码的人
+	Members    []string           `json:"members,omitempty" bson:"members,omitempty"`   // 涉及的成员昵称，比如加入、被移出的成员和新群主
+	NewName    string             `json:"new_name,omitempty" bson:"newName,omitempty"`  // 新群名
+	Notice     string             `json:"notice" bson:"notice"`                         // 原始通知内容
+	MsgId      string             `json:"msg_id" bson:"msgId"`                          // 通知消息ID
+	CreateTime time.Time          `json:"create_time" bson:"createTime"`                // 通知时间
+}
+
+// SetGroupEvent 保存群事件到消息上下文，后面的处理器和插件可以取出来用
+func SetGroupEvent(ctx *openwechat.MessageContext, e *GroupEvent) {
+	ctx.Set(groupEventContextKey, e)
+}
+
+// GroupEventFromContext 从消息上下文取出群事件，不是群事件通知的时候返回false
+func GroupEventFromContext(ctx *openwechat.MessageContext) (*GroupEvent, bool) {
+	value, exist := ctx.Get(groupEventContextKey)
+	if !exist {
+		return nil, false
+	}
+	e, ok := value.(*GroupEvent)
+	return e, ok
+}
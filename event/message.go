@@ -0,0 +1,119 @@
+package event
+
+import (
+	"github.com/eatmoreapple/openwechat"
+	"time"
+	"web-wechat/utils"
+)
+
+// 消息方向
+const (
+	DirectionIn  = "in"  // 收到的消息
+	DirectionOut = "out" // 发出的消息
+)
+
+// 发出消息的来源
+const (
+	SourceSync      = "sync"      // 手机等其他设备发出，同步过来的消息
+	SourceApi       = "api"       // HTTP接口发送
+	SourceWebSocket = "websocket" // WebSocket指令发送
+	SourcePlugin    = "plugin"    // 插件回复
+	SourceSystem    = "system"    // 系统提醒，比如防撤回提醒
+)
+
+// Origin 发出消息的来源信息
+type Origin struct {
+	Source       string `json:"source" bson:"source"`                                   // 来源
+	Name         string `json:"name,omitempty" bson:"name,omitempty"`                   // 接口地址或者插件名称
+	Trigger      string `json:"trigger,omitempty" bson:"trigger,omitempty"`             // 触发者，接口为请求IP，插件为触发消息的发信人ID
+	TriggerMsgId string `json:"trigger_msg_id,omitempty" bson:"triggerMsgId,omitempty"` // 触发插件回复的消息ID
+}
+
+// Delivery 消息发送结果
+type Delivery struct {
+	Success bool   `json:"success" bson:"success"`                 // 是否发送成功
+	Error   string `json:"error,omitempty" bson:"error,omitempty"` // 失败原因
+	Time    int64  `json:"time" bson:"time"`                       // 发送时间戳(秒)
+}
+
+// User 消息相关的联系人信息
+type User struct {
+	Id          string `json:"id" bson:"id"`                              // 唯一ID，多次登录不会变化
+	UserName    string `json:"user_name" bson:"userName"`                 // 当前登录中用户的唯一标识
+	NickName    string `json:"nick_name" bson:"nickName"`                 // 昵称
+	RemarkName  string `json:"remark_name" bson:"remarkName,omitempty"`   // 备注
+	DisplayName string `json:"display_name" bson:"displayName,omitempty"` // 群昵称
+}
+
+// Message 标准化的消息结构
+type Message struct {
+	Uin        int64       `json:"uin"`                 // 消息所属的登录用户
+	MsgId      string      `json:"msg_id"`              // 消息ID，发送失败的消息为空
+	MsgType    int         `json:"msg_type"`            // 消息类型
+	Direction  string      `json:"direction"`           // 消息方向
+	Content    string      `json:"content"`             // 消息内容
+	MediaUrl   string      `json:"media_url,omitempty"` // 图片、视频等文件的链接
+	Sender     *User       `json:"sender"`              // 发信人，群消息为群里的发信人
+	Receiver   *User       `json:"receiver,omitempty"`  // 收信人，群消息为空
+	Group      *User       `json:"group,omitempty"`     // 群组，私聊消息为空
+	Origin     *Origin     `json:"origin,omitempty"`    // 发出消息的来源，收到的消息为空
+	Delivery   *Delivery   `json:"delivery,omitempty"`  // 发送结果，只有本程序发出的消息有
+	Detail     interface{} `json:"detail,omitempty"`    // 按消息类型解析出来的内容，比如位置、名片、转账
+	CreateTime int64       `json:"create_time"`         // 消息发送时间戳(秒)
+}
+
+// Recall 消息撤回事件数据
+type Recall struct {
+	Uin        int64    `json:"uin"`                // 消息所属的登录用户
+	MsgId      string   `json:"msg_id"`             // 被撤回的消息ID
+	Notice     string   `json:"notice"`             // 撤回提示，比如"xxx" 撤回了一条消息
+	Operator   *User    `json:"operator"`           // 撤回消息的人
+	Group      *User    `json:"group,omitempty"`    // 群组，私聊消息为空
+	Original   *Message `json:"original,omitempty"` // 被撤回的原消息，没有保存过的时候为空
+	RecalledAt int64    `json:"recalled_at"`        // 撤回时间戳(秒)
+}
+
+// NewUser 转换联系人信息
+func NewUser(user *openwechat.User) *User {
+	if user == nil {
+		return nil
+	}
+	return &User{
+		Id:          utils.GetUserId(user),
+		UserName:    user.UserName,
+		NickName:    user.NickName,
+		RemarkName:  user.RemarkName,
+		DisplayName: user.DisplayName,
+	}
+}
+
+// PublishSent 发布消息发出事件，receiver为好友或者群组，sendErr不为空时发布发送失败事件
+func PublishSent(appKey string, receiver *openwechat.User, content string, sent *openwechat.SentMessage, sendErr error, origin Origin) {
+	self := receiver.Self()
+	now := time.Now().Unix()
+	msg := Message{
+		Uin:        self.Uin,
+		MsgType:    int(openwechat.MsgTypeText),
+		Direction:  DirectionOut,
+		Content:    content,
+		Sender:     NewUser(self.User),
+		Origin:     &origin,
+		Delivery:   &Delivery{Success: sendErr == nil, Time: now},
+		CreateTime: now,
+	}
+	if sent != nil {
+		msg.MsgId = sent.MsgId
+		msg.MsgType = int(sent.Type)
+	}
+	if receiver.IsGroup() {
+		msg.Group = NewUser(receiver)
+	} else {
+		msg.Receiver = NewUser(receiver)
+	}
+	eventType := MessageSent
+	if sendErr != nil {
+		msg.Delivery.Error = sendErr.Error()
+		eventType = MessageSendFail
+	}
+	Publish(appKey, eventType, msg)
+}
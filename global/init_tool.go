@@ -20,7 +20,7 @@ func InitBotWithStart() {
 		appKey := key[13:]
 		// 调用热登录
 		log.Debugf("当前热登录AppKey: %v", appKey)
-		bot := InitWechatBotHandle()
+		bot := InitWechatBotHandle(appKey)
 		storage := protocol.NewRedisHotReloadStorage(key)
 		if err = bot.HotLogin(storage, openwechat.NewRetryLoginOption()); err != nil {
 			log.Infof("[%v] 热登录失败，错误信息：%v", appKey, err.Error())
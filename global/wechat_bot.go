@@ -1,9 +1,11 @@
 package global
 
 import (
+	"context"
 	"errors"
 	"gitee.ltd/lxh/logger/log"
 	"github.com/eatmoreapple/openwechat"
+	"web-wechat/core"
 	"web-wechat/handler"
 )
 
@@ -37,8 +39,10 @@ func CheckBot(appKey string) error {
 }
 
 // InitWechatBotHandle 初始化微信机器人
-func InitWechatBotHandle() *openwechat.Bot {
-	bot := openwechat.DefaultBot(openwechat.Desktop)
+func InitWechatBotHandle(appKey string) *openwechat.Bot {
+	// AppKey保存到Bot的Context里，消息处理的时候通过Bot取出来
+	botCtx := core.ContextWithAppKey(context.Background(), appKey)
+	bot := openwechat.DefaultBot(openwechat.Desktop, openwechat.WithContextOption{Ctx: botCtx})
 
 	// 定义读取消息错误回调函数
 	//var getMessageErrorCount int32
@@ -21,6 +21,7 @@ require (
 	github.com/PullRequestInc/go-gpt3 v1.1.13
 	github.com/go-redis/redis/v8 v8.11.5
 	github.com/golang-module/carbon/v2 v2.2.3
+	github.com/gorilla/websocket v1.5.0
 	github.com/spf13/viper v1.13.0
 )
 
@@ -1,19 +1,17 @@
 package handler
 
 import (
-	"bytes"
 	"encoding/xml"
 	"fmt"
 	"gitee.ltd/lxh/logger/log"
 	"github.com/eatmoreapple/openwechat"
-	"io"
-	"net/http"
-	"web-wechat/core"
-	"web-wechat/oss"
+	"math"
+	"strconv"
+	"strings"
 )
 
 type AppMessageData struct {
-	XMLName xml.Name `xml:"msg"`
+	XMLName xml.Name `xml:"msg" bson:"-" json:"-"`
 	Appmsg  struct {
 		Appid             string `xml:"appid,attr"`
 		Sdkver            string `xml:"sdkver,attr"`
@@ -52,7 +50,26 @@ type AppMessageData struct {
 			Username       string `xml:"username"`
 			Appid          string `xml:"appid"`
 			Appservicetype string `xml:"appservicetype"`
+			Weappiconurl   string `xml:"weappiconurl"`
 		} `xml:"weappinfo"`
+		Refermsg struct {
+			Type        string `xml:"type"`
+			Svrid       string `xml:"svrid"`
+			Fromusr     string `xml:"fromusr"`
+			Chatusr     string `xml:"chatusr"`
+			Displayname string `xml:"displayname"`
+			Content     string `xml:"content"`
+			Createtime  int64  `xml:"createtime"`
+		} `xml:"refermsg"`
+		Wcpayinfo struct {
+			Paysubtype        int    `xml:"paysubtype"`
+			Feedesc           string `xml:"feedesc"`
+			Transcationid     string `xml:"transcationid"`
+			Transferid        string `xml:"transferid"`
+			Invalidtime       int64  `xml:"invalidtime"`
+			Begintransfertime int64  `xml:"begintransfertime"`
+			PayMemo           string `xml:"pay_memo"`
+		} `xml:"wcpayinfo"`
 		Websearch string `xml:"websearch"`
 	} `xml:"appmsg"`
 	Fromusername string `xml:"fromusername"`
@@ -62,6 +79,110 @@ type AppMessageData struct {
 		Appname string `xml:"appname"`
 	} `xml:"appinfo"`
 	Commenturl string `xml:"commenturl"`
+
+	// 按子类型解析出来的内容
+	Link        *AppLink        `xml:"-" bson:"link,omitempty" json:"link,omitempty"`                // 链接卡片
+	MiniProgram *AppMiniProgram `xml:"-" bson:"miniProgram,omitempty" json:"mini_program,omitempty"` // 小程序卡片
+	File        *AppFile        `xml:"-" bson:"file,omitempty" json:"file,omitempty"`                // 文件
+	Quote       *AppQuote       `xml:"-" bson:"quote,omitempty" json:"quote,omitempty"`              // 引用回复
+	ChatRecord  *AppChatRecord  `xml:"-" bson:"chatRecord,omitempty" json:"chat_record,omitempty"`   // 聊天记录
+	Transfer    *AppTransfer    `xml:"-" bson:"transfer,omitempty" json:"transfer,omitempty"`        // 转账
+}
+
+// APP消息子类型
+const (
+	appMsgTypeLink            = "5"    // 链接
+	appMsgTypeFile            = "6"    // 文件
+	appMsgTypeChatRecord      = "19"   // 聊天记录
+	appMsgTypeMiniProgram     = "33"   // 小程序
+	appMsgTypeMiniProgramPage = "36"   // 小程序页面
+	appMsgTypeQuote           = "57"   // 引用回复
+	appMsgTypeTransfer        = "2000" // 转账
+	appMsgTypeRedPacket       = "2001" // 红包
+)
+
+// 转账状态
+var transferStatus = map[int]string{
+	1: "pending",  // 待收款
+	3: "received", // 已收款
+	4: "refunded", // 已退还
+}
+
+// AppLink 链接卡片
+type AppLink struct {
+	Title       string `bson:"title" json:"title"`                                 // 标题
+	Description string `bson:"description,omitempty" json:"description,omitempty"` // 描述
+	Url         string `bson:"url" json:"url"`                                     // 链接地址
+	ThumbUrl    string `bson:"thumbUrl,omitempty" json:"thumb_url,omitempty"`      // 缩略图
+	Source      string `bson:"source,omitempty" json:"source,omitempty"`           // 来源公众号或者APP
+}
+
+// AppMiniProgram 小程序卡片
+type AppMiniProgram struct {
+	Title    string `bson:"title" json:"title"`                            // 标题
+	AppId    string `bson:"appId" json:"app_id"`                           // 小程序AppId
+	UserName string `bson:"userName" json:"user_name"`                     // 小程序原始ID
+	PagePath string `bson:"pagePath,omitempty" json:"page_path,omitempty"` // 页面路径
+	IconUrl  string `bson:"iconUrl,omitempty" json:"icon_url,omitempty"`   // 小程序图标
+	Source   string `bson:"source,omitempty" json:"source,omitempty"`      // 小程序名称
+}
+
+// AppFile 文件
+type AppFile struct {
+	Name string `bson:"name" json:"name"`                   // 文件名
+	Size int64  `bson:"size" json:"size"`                   // 文件大小(字节)
+	Ext  string `bson:"ext,omitempty" json:"ext,omitempty"` // 扩展名
+	Md5  string `bson:"md5,omitempty" json:"md5,omitempty"` // 文件MD5
+}
+
+// AppQuote 引用回复
+type AppQuote struct {
+	Content        string `bson:"content" json:"content"`                                     // 回复内容
+	RefMsgId       string `bson:"refMsgId" json:"ref_msg_id"`                                 // 被引用的消息ID
+	RefMsgType     int    `bson:"refMsgType" json:"ref_msg_type"`                             // 被引用的消息类型
+	RefSender      string `bson:"refSender,omitempty" json:"ref_sender,omitempty"`            // 被引用消息的发信人
+	RefDisplayName string `bson:"refDisplayName,omitempty" json:"ref_display_name,omitempty"` // 被引用消息发信人的显示名称
+	RefContent     string `bson:"refContent,omitempty" json:"ref_content,omitempty"`          // 被引用的消息内容
+	RefCreateTime  int64  `bson:"refCreateTime,omitempty" json:"ref_create_time,omitempty"`   // 被引用消息的发送时间戳(秒)
+}
+
+// AppTransfer 转账
+type AppTransfer struct {
+	Amount        string `bson:"amount" json:"amount"`                                // 金额，单位元
+	AmountFen     int64  `bson:"amountFen" json:"amount_fen"`                         // 金额，单位分
+	Status        string `bson:"status" json:"status"`                                // 状态: pending-待收款 received-已收款 refunded-已退还
+	PaySubType    int    `bson:"paySubType" json:"pay_sub_type"`                      // 微信原始的状态值
+	TransferId    string `bson:"transferId" json:"transfer_id"`                       // 转账单号
+	TransactionId string `bson:"transactionId" json:"transaction_id"`                 // 交易单号
+	Memo          string `bson:"memo,omitempty" json:"memo,omitempty"`                // 转账备注
+	Description   string `bson:"description,omitempty" json:"description,omitempty"`  // 描述，比如收到转账0.01元
+	BeginTime     int64  `bson:"beginTime,omitempty" json:"begin_time,omitempty"`     // 转账时间戳(秒)
+	InvalidTime   int64  `bson:"invalidTime,omitempty" json:"invalid_time,omitempty"` // 过期时间戳(秒)
+}
+
+// AppChatRecord 聊天记录
+type AppChatRecord struct {
+	Title       string              `bson:"title" json:"title"`                                 // 标题
+	Description string              `bson:"description,omitempty" json:"description,omitempty"` // 摘要
+	Items       []AppChatRecordItem `bson:"items" json:"items"`                                 // 记录列表
+}
+
+// AppChatRecordItem 聊天记录里的一条消息
+type AppChatRecordItem struct {
+	DataType   int    `xml:"datatype,attr" bson:"dataType" json:"data_type"`          // 消息类型，1为文本
+	SourceName string `xml:"sourcename" bson:"sourceName" json:"source_name"`         // 发信人
+	SourceTime string `xml:"sourcetime" bson:"sourceTime" json:"source_time"`         // 发送时间
+	Content    string `xml:"datadesc" bson:"content" json:"content"`                  // 内容
+	Title      string `xml:"datatitle" bson:"title,omitempty" json:"title,omitempty"` // 文件、链接等的标题
+	Ext        string `xml:"datafmt" bson:"ext,omitempty" json:"ext,omitempty"`       // 文件扩展名
+}
+
+// 聊天记录的recorditem内容
+type appRecordInfo struct {
+	XMLName  xml.Name            `xml:"recordinfo"`
+	Title    string              `xml:"title"`
+	Desc     string              `xml:"desc"`
+	DataList []AppChatRecordItem `xml:"datalist>dataitem"`
 }
 
 // APP消息处理
@@ -74,61 +195,126 @@ func appMessageHandle(ctx *openwechat.MessageContext) {
 		senderInGroup, _ := ctx.SenderInGroup()
 		senderUser = fmt.Sprintf("%v[%v]", senderInGroup.NickName, senderUser)
 	}
-	// 解析文件
-	var data AppMessageData
-	if err := xml.Unmarshal([]byte(ctx.Content), &data); err != nil {
+	// 解析消息内容
+	data, err := parseAppMessage(ctx.Content)
+	if err != nil {
 		log.Errorf("消息解析失败: %v", err.Error())
 		log.Debugf("原始内容: %v", ctx.Content)
 		return
-	} else {
-		log.Infof("[收到新文件消息] == 发信人：%v ==> Type：%v ==> 标题：%v ==> 来源APP: %v",
-			senderUser, data.Appmsg.Type, data.Appmsg.Title, data.Appinfo.Appname)
-		tt := data.Appmsg.Type
-		dealType := []string{"2", "3", "4", "6", "15"}
-		if !checkIsExist(dealType, tt) {
-			log.Infof("奇奇怪怪的未定义处理类型，跳过处理。类型: %v", tt)
-			return
+	}
+	log.Infof("[收到新APP消息] == 发信人：%v ==> Type：%v ==> 标题：%v ==> 来源APP: %v",
+		senderUser, data.Appmsg.Type, data.Appmsg.Title, data.Appinfo.Appname)
+	ctx.Set(messageDataKey, data)
+
+	switch {
+	case data.File != nil:
+		// 只有文件消息有附件可以下载
+		saveAppFile(ctx, data)
+	case data.Transfer != nil:
+		log.Infof("[转账] %v ==> 金额：%v ==> 状态：%v", data.Transfer.Description, data.Transfer.Amount, data.Transfer.Status)
+	case data.Appmsg.Type == appMsgTypeRedPacket:
+		// 红包和系统通知里的红包一样只保存到消息的红包字段
+		ctx.Set(messageDataKey, newAppRedPacket(data, ctx.IsSendBySelf()))
+	}
+	ctx.Next()
+}
+
+// 解析APP消息的XML，按子类型取出链接、小程序、文件等内容
+func parseAppMessage(content string) (*AppMessageData, error) {
+	var data AppMessageData
+	if err := xml.Unmarshal([]byte(content), &data); err != nil {
+		return nil, err
+	}
+	appmsg := data.Appmsg
+	switch appmsg.Type {
+	case appMsgTypeLink:
+		data.Link = &AppLink{
+			Title:       appmsg.Title,
+			Description: appmsg.Des,
+			Url:         appmsg.URL,
+			ThumbUrl:    appmsg.Thumburl,
+			Source:      appmsg.Sourcedisplayname,
+		}
+		if data.Link.Source == "" {
+			data.Link.Source = data.Appinfo.Appname
+		}
+	case appMsgTypeMiniProgram, appMsgTypeMiniProgramPage:
+		data.MiniProgram = &AppMiniProgram{
+			Title:    appmsg.Title,
+			AppId:    appmsg.Weappinfo.Appid,
+			UserName: appmsg.Weappinfo.Username,
+			PagePath: appmsg.Weappinfo.Pagepath,
+			IconUrl:  appmsg.Weappinfo.Weappiconurl,
+			Source:   appmsg.Sourcedisplayname,
 		}
-		// 下载图片资源
-		fileResp, err := ctx.GetFile()
-		if err != nil {
-			log.Errorf("文件下载失败: %v", err.Error())
-			return
+	case appMsgTypeFile:
+		size, _ := strconv.ParseInt(appmsg.Appattach.Totallen, 10, 64)
+		data.File = &AppFile{Name: appmsg.Title, Size: size, Ext: appmsg.Appattach.Fileext, Md5: appmsg.Md5}
+	case appMsgTypeQuote:
+		refType, _ := strconv.Atoi(appmsg.Refermsg.Type)
+		data.Quote = &AppQuote{
+			Content:        appmsg.Title,
+			RefMsgId:       appmsg.Refermsg.Svrid,
+			RefMsgType:     refType,
+			RefSender:      appmsg.Refermsg.Fromusr,
+			RefDisplayName: appmsg.Refermsg.Displayname,
+			RefContent:     appmsg.Refermsg.Content,
+			RefCreateTime:  appmsg.Refermsg.Createtime,
 		}
-		defer fileResp.Body.Close()
-		imgFileByte, err := io.ReadAll(fileResp.Body)
-		if err != nil {
-			log.Errorf("文件读取错误: %v", err.Error())
-			return
-		} else {
-			// 读取文件相关信息
-			contentType := http.DetectContentType(imgFileByte)
-			fileName := fmt.Sprintf("%v_%v", ctx.MsgId, data.Appmsg.Title)
-			if user, err := ctx.Bot().GetCurrentUser(); err == nil {
-				uin := user.Uin
-				fileName = fmt.Sprintf("%v/%v", uin, fileName)
-			}
-			// 上传文件(reader2解决上传空文件的BUG,因为http.Response.Body只允许读一次)
-			reader2 := io.NopCloser(bytes.NewReader(imgFileByte))
-			flag := oss.SaveToOss(reader2, contentType, fileName)
-			if flag {
-				fileUrl := fmt.Sprintf("https://%v/%v/%v", core.SystemConfig.OssConfig.Endpoint, core.SystemConfig.OssConfig.BucketName, fileName)
-				log.Infof("文件保存成功，文件链接: %v", fileUrl)
-				ctx.Content = fileUrl
-			} else {
-				log.Error("文件保存失败")
-			}
+	case appMsgTypeChatRecord:
+		data.ChatRecord = &AppChatRecord{Title: appmsg.Title, Description: appmsg.Des, Items: []AppChatRecordItem{}}
+		var record appRecordInfo
+		if err := xml.Unmarshal([]byte(appmsg.Recorditem), &record); err != nil {
+			log.Errorf("聊天记录解析失败: %v", err.Error())
+		} else if record.DataList != nil {
+			data.ChatRecord.Items = record.DataList
 		}
+	case appMsgTypeTransfer:
+		data.Transfer = newAppTransfer(&data)
+	case appMsgTypeRedPacket:
+		// 红包由消息处理器转换为红包通知
+	default:
+		log.Infof("未单独处理的APP消息类型，只保存原始内容。类型: %v", appmsg.Type)
 	}
-	ctx.Next()
+	return &data, nil
 }
 
-// 判断数组是否包含某个元素
-func checkIsExist(a []string, k string) bool {
-	for _, item := range a {
-		if item == k {
-			return true
-		}
+// 解析转账信息
+func newAppTransfer(data *AppMessageData) *AppTransfer {
+	info := data.Appmsg.Wcpayinfo
+	transfer := AppTransfer{
+		Amount:        strings.TrimLeft(strings.TrimSpace(info.Feedesc), "￥¥"),
+		Status:        transferStatus[info.Paysubtype],
+		PaySubType:    info.Paysubtype,
+		TransferId:    info.Transferid,
+		TransactionId: info.Transcationid,
+		Memo:          info.PayMemo,
+		Description:   data.Appmsg.Des,
+		BeginTime:     info.Begintransfertime,
+		InvalidTime:   info.Invalidtime,
+	}
+	if transfer.Status == "" {
+		transfer.Status = "unknown"
+	}
+	if amount, err := strconv.ParseFloat(transfer.Amount, 64); err == nil {
+		transfer.AmountFen = int64(math.Round(amount * 100))
+	}
+	return &transfer
+}
+
+// 红包消息转换为红包通知，网页版同样只能拿到标题
+func newAppRedPacket(data *AppMessageData, sendBySelf bool) *RedPacketMessageData {
+	redPacket := RedPacketMessageData{Action: redPacketReceived, Notice: data.Appmsg.Title}
+	if sendBySelf {
+		redPacket.Action = redPacketSent
+	}
+	return &redPacket
+}
+
+// 下载文件消息的附件并保存到OSS，文件名保存在消息的文件信息里
+func saveAppFile(ctx *openwechat.MessageContext, data *AppMessageData) {
+	record := saveMessageMedia(ctx, mediaOption{kind: mediaKindFile, label: "文件", download: ctx.GetFile, sourceMd5: data.Appmsg.Md5})
+	if record != nil && data.File.Size == 0 {
+		data.File.Size = record.Size
 	}
-	return false
 }
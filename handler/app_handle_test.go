@@ -0,0 +1,142 @@
+package handler
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParseAppMessage(t *testing.T) {
+	cases := []struct {
+		fixture string
+		check   func(t *testing.T, data *AppMessageData)
+	}{
+		{"link.xml", func(t *testing.T, data *AppMessageData) {
+			want := &AppLink{
+				Title:       "Go 1.20 发布说明",
+				Description: "Go 1.20 新特性一览",
+				Url:         "https://mp.weixin.qq.com/s/abcdef",
+				ThumbUrl:    "https://mmbiz.qpic.cn/thumb.jpg",
+				Source:      "Go语言中文网",
+			}
+			if !reflect.DeepEqual(data.Link, want) {
+				t.Fatalf("链接解析错误: %+v", data.Link)
+			}
+		}},
+		{"mini_program.xml", func(t *testing.T, data *AppMessageData) {
+			want := &AppMiniProgram{
+				Title:    "今天吃什么",
+				AppId:    "wx1234567890abcdef",
+				UserName: "gh_abcdef123456@app",
+				PagePath: "pages/index/index.html?id=1",
+				IconUrl:  "https://wx.qlogo.cn/icon.png",
+				Source:   "美食小助手",
+			}
+			if !reflect.DeepEqual(data.MiniProgram, want) {
+				t.Fatalf("小程序解析错误: %+v", data.MiniProgram)
+			}
+		}},
+		{"file.xml", func(t *testing.T, data *AppMessageData) {
+			want := &AppFile{Name: "2023年度报告.pdf", Size: 1048576, Ext: "pdf", Md5: "9e107d9d372bb6826bd81d3542a419d6"}
+			if !reflect.DeepEqual(data.File, want) {
+				t.Fatalf("文件解析错误: %+v", data.File)
+			}
+		}},
+		{"quote.xml", func(t *testing.T, data *AppMessageData) {
+			want := &AppQuote{
+				Content:        "好的，明天见",
+				RefMsgId:       "1234567890123456789",
+				RefMsgType:     1,
+				RefSender:      "wxid_friend",
+				RefDisplayName: "张三",
+				RefContent:     "明天下午三点开会",
+				RefCreateTime:  1670000000,
+			}
+			if !reflect.DeepEqual(data.Quote, want) {
+				t.Fatalf("引用回复解析错误: %+v", data.Quote)
+			}
+		}},
+		{"chat_record.xml", func(t *testing.T, data *AppMessageData) {
+			record := data.ChatRecord
+			if record == nil || record.Title != "张三和李四的聊天记录" || len(record.Items) != 3 {
+				t.Fatalf("聊天记录解析错误: %+v", record)
+			}
+			want := AppChatRecordItem{DataType: 1, SourceName: "张三", SourceTime: "2023-06-01 10:00:00", Content: "周末去爬山吗"}
+			if record.Items[0] != want {
+				t.Fatalf("聊天记录内容错误: %+v", record.Items[0])
+			}
+			if file := record.Items[2]; file.DataType != 8 || file.Title != "路线.pdf" || file.Ext != "pdf" {
+				t.Fatalf("聊天记录里的文件解析错误: %+v", file)
+			}
+		}},
+	}
+	for _, c := range cases {
+		t.Run(c.fixture, func(t *testing.T) {
+			content, err := os.ReadFile(filepath.Join("testdata", "appmsg", c.fixture))
+			if err != nil {
+				t.Fatal(err)
+			}
+			data, err := parseAppMessage(string(content))
+			if err != nil {
+				t.Fatal(err)
+			}
+			// 每种子类型只解析出对应的内容
+			parsed := 0
+			for _, v := range []interface{}{data.Link, data.MiniProgram, data.File, data.Quote, data.ChatRecord, data.Transfer} {
+				if !reflect.ValueOf(v).IsNil() {
+					parsed++
+				}
+			}
+			if parsed != 1 {
+				t.Fatalf("应该只解析出一种内容，实际%v种", parsed)
+			}
+			c.check(t, data)
+		})
+	}
+}
+
+func TestNewAppTransfer(t *testing.T) {
+	cases := []struct {
+		paySubType int
+		status     string
+	}{
+		{1, "pending"},
+		{3, "received"},
+		{4, "refunded"},
+		{8, "unknown"},
+	}
+	for _, c := range cases {
+		var data AppMessageData
+		data.Appmsg.Type = appMsgTypeTransfer
+		data.Appmsg.Des = "收到转账0.01元"
+		data.Appmsg.Wcpayinfo.Paysubtype = c.paySubType
+		data.Appmsg.Wcpayinfo.Feedesc = " ￥12.34 "
+		data.Appmsg.Wcpayinfo.Transferid = "1000050001202306010000000000000"
+		data.Appmsg.Wcpayinfo.PayMemo = "午饭"
+		transfer := newAppTransfer(&data)
+		if transfer.Status != c.status || transfer.PaySubType != c.paySubType {
+			t.Fatalf("状态%v解析错误: %+v", c.paySubType, transfer)
+		}
+		if transfer.Amount != "12.34" || transfer.AmountFen != 1234 || transfer.Memo != "午饭" || transfer.Description != "收到转账0.01元" {
+			t.Fatalf("转账信息解析错误: %+v", transfer)
+		}
+	}
+}
+
+func TestNewAppRedPacket(t *testing.T) {
+	content := `<msg><appmsg><title>恭喜发财，大吉大利</title><type>2001</type><wcpayinfo><paysubtype>0</paysubtype></wcpayinfo></appmsg></msg>`
+	data, err := parseAppMessage(content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data.Transfer != nil {
+		t.Fatal("红包不应该解析为转账")
+	}
+	if r := newAppRedPacket(data, false); r.Action != redPacketReceived || r.Notice != "恭喜发财，大吉大利" {
+		t.Fatalf("收到的红包解析错误: %+v", r)
+	}
+	if r := newAppRedPacket(data, true); r.Action != redPacketSent {
+		t.Fatalf("发出的红包解析错误: %+v", r)
+	}
+}
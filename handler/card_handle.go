@@ -0,0 +1,54 @@
+package handler
+
+import (
+	"fmt"
+	"gitee.ltd/lxh/logger/log"
+	"github.com/eatmoreapple/openwechat"
+)
+
+// CardMessageData 名片消息结构体
+type CardMessageData struct {
+	UserName   string `bson:"userName" json:"user_name"`                          // 名片用户的UserName
+	NickName   string `bson:"nickName" json:"nick_name"`                          // 昵称
+	Alias      string `bson:"alias,omitempty" json:"alias,omitempty"`             // 微信号
+	Sex        int    `bson:"sex" json:"sex"`                                     // 性别: 0-未知 1-男 2-女
+	Province   string `bson:"province,omitempty" json:"province,omitempty"`       // 省份
+	City       string `bson:"city,omitempty" json:"city,omitempty"`               // 城市
+	Sign       string `bson:"sign,omitempty" json:"sign,omitempty"`               // 个性签名
+	HeadImgUrl string `bson:"headImgUrl,omitempty" json:"head_img_url,omitempty"` // 头像
+	IsOfficial bool   `bson:"isOfficial" json:"is_official"`                      // 是否是公众号名片
+}
+
+// 名片消息处理
+func cardMessageHandle(ctx *openwechat.MessageContext) {
+	sender, _ := ctx.Sender()
+	senderUser := sender.NickName
+	if ctx.IsSendByGroup() {
+		// 取出消息在群里面的发送者
+		senderInGroup, _ := ctx.SenderInGroup()
+		senderUser = fmt.Sprintf("%v[%v]", senderInGroup.NickName, senderUser)
+	}
+	card, err := ctx.Card()
+	if err != nil {
+		log.Errorf("名片消息解析失败: %v", err.Error())
+		log.Debugf("发信人: %v ==> 原始内容: %v", senderUser, ctx.Content)
+		return
+	}
+	data := CardMessageData{
+		UserName:   card.UserName,
+		NickName:   card.NickName,
+		Alias:      card.Alias,
+		Sex:        card.Sex,
+		Province:   card.Province,
+		City:       card.City,
+		Sign:       card.Sign,
+		HeadImgUrl: card.BigHeadImgUrl,
+		IsOfficial: card.BrandIconUrl != "" || card.Certflag != 0,
+	}
+	if data.HeadImgUrl == "" {
+		data.HeadImgUrl = card.SmallHeadImgUrl
+	}
+	ctx.Set(messageDataKey, &data)
+	log.Infof("[收到新名片消息] == 发信人：%v ==> 名片：%v", senderUser, data.NickName)
+	ctx.Next()
+}
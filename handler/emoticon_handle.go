@@ -1,21 +1,16 @@
 package handler
 
 import (
-	"bytes"
 	"encoding/xml"
 	"fmt"
 	"gitee.ltd/lxh/logger/log"
 	"github.com/eatmoreapple/openwechat"
-	"io"
-	"net/http"
 	"strings"
-	"web-wechat/core"
-	"web-wechat/oss"
 )
 
 // EmoticonMessageData 表情包消息结构体
 type EmoticonMessageData struct {
-	XMLName xml.Name `xml:"msg"`
+	XMLName xml.Name `xml:"msg" bson:"-" json:"-"`
 	Emoji   struct {
 		Fromusername      string `xml:"fromusername,attr"`
 		Tousername        string `xml:"tousername,attr"`
@@ -77,37 +72,9 @@ func emoticonMessageHandle(ctx *openwechat.MessageContext) {
 			return
 		} else {
 			log.Infof("[收到新表情包消息] == 发信人：%v ==> 内容：%v", senderUser, data.Emoji.Md5)
+			ctx.Set(messageDataKey, &data)
 			// 下载图片资源
-			fileResp, err := ctx.GetFile()
-			if err != nil {
-				log.Errorf("表情包下载失败: %v", err.Error())
-				return
-			}
-			defer fileResp.Body.Close()
-			imgFileByte, err := io.ReadAll(fileResp.Body)
-			if err != nil {
-				log.Errorf("表情包读取错误: %v", err.Error())
-				return
-			} else {
-				// 读取文件相关信息
-				contentType := http.DetectContentType(imgFileByte)
-				fileType := strings.Split(contentType, "/")[1]
-				fileName := fmt.Sprintf("%v.%v", ctx.MsgId, fileType)
-				if user, err := ctx.Bot().GetCurrentUser(); err == nil {
-					uin := user.Uin
-					fileName = fmt.Sprintf("%v/%v", uin, fileName)
-				}
-				// 上传文件(reader2解决上传空文件的BUG,因为http.Response.Body只允许读一次)
-				reader2 := io.NopCloser(bytes.NewReader(imgFileByte))
-				flag := oss.SaveToOss(reader2, contentType, fileName)
-				if flag {
-					fileUrl := fmt.Sprintf("https://%v/%v/%v", core.SystemConfig.OssConfig.Endpoint, core.SystemConfig.OssConfig.BucketName, fileName)
-					log.Infof("表情包保存成功，图片链接: %v", fileUrl)
-					ctx.Content = fileUrl
-				} else {
-					log.Error("表情包保存失败")
-				}
-			}
+			saveMessageMedia(ctx, mediaOption{kind: mediaKindEmoticon, label: "表情包", download: ctx.GetFile, sourceMd5: data.Emoji.Md5})
 		}
 	}
 	ctx.Next()
@@ -0,0 +1,56 @@
+package handler
+
+import (
+	"github.com/eatmoreapple/openwechat"
+	"web-wechat/core"
+	"web-wechat/event"
+)
+
+// 检查是否需要发布事件
+func checkNeedPublish(message *openwechat.Message) bool {
+	// 通知消息不发布，撤回消息由撤回处理器单独发布
+	return !message.IsNotify() && !message.IsRecalled()
+}
+
+// 发布收到消息的事件，自己在手机上发出的消息作为发出消息的事件发布
+func publishMessage(ctx *openwechat.MessageContext) {
+	// 群系统通知已经作为群事件发布过了，不再作为消息重复发布
+	if _, ok := event.GroupEventFromContext(ctx); ok {
+		ctx.Next()
+		return
+	}
+	appKey := core.AppKeyFromContext(ctx.Bot().Context())
+
+	msg := event.Message{
+		MsgId:      ctx.MsgId,
+		MsgType:    int(ctx.MsgType),
+		Direction:  event.DirectionIn,
+		Content:    ctx.Content,
+		CreateTime: ctx.CreateTime,
+	}
+	if self, err := ctx.Bot().GetCurrentUser(); err == nil {
+		msg.Uin = self.Uin
+	}
+	if record := getMediaRecord(ctx); record != nil {
+		msg.MediaUrl = record.Url
+		if mediaProxied() {
+			msg.MediaUrl = mediaProxyUrl(ctx.MsgId, false)
+		}
+	}
+	if data, exist := ctx.Get(messageDataKey); exist {
+		msg.Detail = data
+	}
+	sender, receiver, group := messageUsers(ctx)
+	msg.Sender = event.NewUser(sender)
+	msg.Receiver = event.NewUser(receiver)
+	msg.Group = event.NewUser(group)
+
+	eventType := event.MessageReceived
+	if ctx.IsSendBySelf() {
+		msg.Direction = event.DirectionOut
+		msg.Origin = &event.Origin{Source: event.SourceSync}
+		eventType = event.MessageSent
+	}
+	event.Publish(appKey, eventType, msg)
+	ctx.Next()
+}
@@ -0,0 +1,125 @@
+package handler
+
+import (
+	"gitee.ltd/lxh/logger/log"
+	"github.com/eatmoreapple/openwechat"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"regexp"
+	"strings"
+	"time"
+	"web-wechat/core"
+	. "web-wechat/db"
+	"web-wechat/event"
+)
+
+// GroupEventTableName 保存群事件的表名
+const GroupEventTableName = "group_event"
+
+// 通知里的昵称，自己是"你"，其他人用双引号括起来
+const noticeName = `(你|"[^"]+")`
+
+// 群系统通知的格式
+var (
+	inviteNoticeRegexp = regexp.MustCompile(`^` + noticeName + `邀请` + noticeName + `加入了群聊`)
+	qrCodeNoticeRegexp = regexp.MustCompile(`^` + noticeName + `通过扫描` + noticeName + `分享的二维码加入群聊`)
+	removeNoticeRegexp = regexp.MustCompile(`^你将("[^"]+")移出了群聊`)
+	beRemovedRegexp    = regexp.MustCompile(`^你被("[^"]+")移出群聊`)
+	renameNoticeRegexp = regexp.MustCompile(`^` + noticeName + `修改群名为“(.+)”`)
+	ownerNoticeRegexp  = regexp.MustCompile(`^` + noticeName + `已成为新群主`)
+	noticeTagRegexp    = regexp.MustCompile(`<[^>]+>`)
+)
+
+// InitGroupEventIndex 初始化群事件表索引
+func InitGroupEventIndex() {
+	models := []mongo.IndexModel{
+		{Keys: bson.D{{Key: "uin", Value: 1}, {Key: "group.id", Value: 1}, {Key: "createTime", Value: -1}}},
+	}
+	if err := MongoClient.CreateIndexes(GroupEventTableName, models); err != nil {
+		log.Errorf("群事件表索引初始化失败: %v", err.Error())
+	}
+}
+
+// 检查是否是群系统通知
+func checkIsGroupNotice(message *openwechat.Message) bool {
+	return message.IsSystem() && message.IsComeFromGroup()
+}
+
+// 群系统通知处理，解析成群事件保存并发布，插件可以通过event.GroupEventFromContext取出
+func groupNoticeHandle(ctx *openwechat.MessageContext) {
+	// 获取不到登录用户的时候照常解析，Uin为0，通知里的"你"不替换
+	var uin int64
+	selfName := "你"
+	if self, err := ctx.Bot().GetCurrentUser(); err == nil {
+		uin, selfName = self.Uin, self.NickName
+	} else {
+		log.Errorf("获取登录用户失败: %v", err.Error())
+	}
+	e := parseGroupNotice(ctx.Content, selfName)
+	if e == nil {
+		// 拍一拍之类的其他系统通知
+		ctx.Next()
+		return
+	}
+	_, _, group := messageUsers(ctx)
+	e.Uin = uin
+	e.Group = event.NewUser(group)
+	e.MsgId = ctx.MsgId
+	e.CreateTime = time.Unix(ctx.CreateTime, 0)
+	event.SetGroupEvent(ctx, e)
+
+	groupName := ""
+	if e.Group != nil {
+		groupName = e.Group.NickName
+	}
+	log.Infof("[群事件] == 群组：%v ==> 类型：%v ==> 通知：%v", groupName, e.Type, e.Notice)
+	MongoClient.Save(e, GroupEventTableName)
+	event.Publish(core.AppKeyFromContext(ctx.Bot().Context()), e.Type, e)
+	ctx.Next()
+}
+
+// 解析群系统通知，不是群成员相关的通知返回nil，selfName用来替换通知里的"你"
+func parseGroupNotice(content, selfName string) *event.GroupEvent {
+	notice := strings.TrimSpace(noticeTagRegexp.ReplaceAllString(content, ""))
+	name := func(s string) string {
+		if s == "你" {
+			return selfName
+		}
+		return strings.Trim(s, `"`)
+	}
+	names := func(s string) []string {
+		if s == "你" {
+			return []string{selfName}
+		}
+		return strings.Split(strings.Trim(s, `"`), "、")
+	}
+
+	e := event.GroupEvent{Notice: notice}
+	if m := inviteNoticeRegexp.FindStringSubmatch(notice); m != nil {
+		e.Type = event.GroupMemberJoined
+		e.Inviter = name(m[1])
+		e.Members = names(m[2])
+	} else if m = qrCodeNoticeRegexp.FindStringSubmatch(notice); m != nil {
+		e.Type = event.GroupMemberJoined
+		e.Members = names(m[1])
+		e.Inviter = name(m[2])
+	} else if m = removeNoticeRegexp.FindStringSubmatch(notice); m != nil {
+		e.Type = event.GroupMemberRemoved
+		e.Operator = selfName
+		e.Members = names(m[1])
+	} else if m = beRemovedRegexp.FindStringSubmatch(notice); m != nil {
+		e.Type = event.GroupMemberRemoved
+		e.Operator = name(m[1])
+		e.Members = []string{selfName}
+	} else if m = renameNoticeRegexp.FindStringSubmatch(notice); m != nil {
+		e.Type = event.GroupRenamed
+		e.Operator = name(m[1])
+		e.NewName = m[2]
+	} else if m = ownerNoticeRegexp.FindStringSubmatch(notice); m != nil {
+		e.Type = event.GroupOwnerChanged
+		e.Members = names(m[1])
+	} else {
+		return nil
+	}
+	return &e
+}
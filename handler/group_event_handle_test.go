@@ -0,0 +1,40 @@
+package handler
+
+import (
+	"reflect"
+	"testing"
+	"web-wechat/event"
+)
+
+func TestParseGroupNotice(t *testing.T) {
+	cases := []struct {
+		content string
+		want    *event.GroupEvent
+	}{
+		{`"张三"邀请"李四、王五"加入了群聊`, &event.GroupEvent{Type: event.GroupMemberJoined, Inviter: "张三", Members: []string{"李四", "王五"}}},
+		{`你邀请"李四"加入了群聊`, &event.GroupEvent{Type: event.GroupMemberJoined, Inviter: "我", Members: []string{"李四"}}},
+		{`"李四"通过扫描"张三"分享的二维码加入群聊`, &event.GroupEvent{Type: event.GroupMemberJoined, Inviter: "张三", Members: []string{"李四"}}},
+		{`你将"李四"移出了群聊`, &event.GroupEvent{Type: event.GroupMemberRemoved, Operator: "我", Members: []string{"李四"}}},
+		{`你被"张三"移出群聊`, &event.GroupEvent{Type: event.GroupMemberRemoved, Operator: "张三", Members: []string{"我"}}},
+		{`"张三"修改群名为“新群名”`, &event.GroupEvent{Type: event.GroupRenamed, Operator: "张三", NewName: "新群名"}},
+		{`"张三"已成为新群主`, &event.GroupEvent{Type: event.GroupOwnerChanged, Members: []string{"张三"}}},
+		{`"张三" 拍了拍我`, nil},
+	}
+	for _, c := range cases {
+		got := parseGroupNotice(c.content, "我")
+		if c.want == nil {
+			if got != nil {
+				t.Errorf("%v: 不应该解析出群事件，实际: %+v", c.content, got)
+			}
+			continue
+		}
+		if got == nil {
+			t.Errorf("%v: 没有解析出群事件", c.content)
+			continue
+		}
+		c.want.Notice = c.content
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%v: 解析结果错误\n期望: %+v\n实际: %+v", c.content, c.want, got)
+		}
+	}
+}
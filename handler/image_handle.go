@@ -1,21 +1,16 @@
 package handler
 
 import (
-	"bytes"
 	"encoding/xml"
 	"fmt"
 	"gitee.ltd/lxh/logger/log"
 	"github.com/eatmoreapple/openwechat"
-	"io"
-	"net/http"
 	"strings"
-	"web-wechat/core"
-	"web-wechat/oss"
 )
 
 // ImageMessageData 图片消息结构体
 type ImageMessageData struct {
-	XMLName xml.Name `xml:"msg"`
+	XMLName xml.Name `xml:"msg" bson:"-" json:"-"`
 	Img     struct {
 		Text           string `xml:",chardata"`
 		AesKey         string `xml:"aeskey,attr"`
@@ -54,40 +49,12 @@ func imageMessageHandle(ctx *openwechat.MessageContext) {
 		log.Errorf("消息解析失败: %v", err.Error())
 		log.Debugf("发信人: %v ==> 原始内容: %v", senderUser, ctx.Content)
 		return
+	} else {
+		ctx.Set(messageDataKey, &data)
 	}
 
 	log.Infof("[收到新图片消息] == 发信人：%v", senderUser)
 	// 下载图片资源
-	fileResp, err := ctx.GetFile()
-	if err != nil {
-		log.Errorf("图片下载失败: %v", err.Error())
-		return
-	}
-	defer fileResp.Body.Close()
-	imgFileByte, err := io.ReadAll(fileResp.Body)
-	if err != nil {
-		log.Errorf("图片读取错误: %v", err.Error())
-		return
-	} else {
-		// 读取文件相关信息
-		contentType := http.DetectContentType(imgFileByte)
-		fileType := strings.Split(contentType, "/")[1]
-		fileName := fmt.Sprintf("%v.%v", ctx.MsgId, fileType)
-		if user, err := ctx.Bot().GetCurrentUser(); err == nil {
-			uin := user.Uin
-			fileName = fmt.Sprintf("%v/%v", uin, fileName)
-		}
-
-		// 上传文件
-		reader2 := io.NopCloser(bytes.NewReader(imgFileByte))
-		flag := oss.SaveToOss(reader2, contentType, fileName)
-		if flag {
-			fileUrl := fmt.Sprintf("https://%v/%v/%v", core.SystemConfig.OssConfig.Endpoint, core.SystemConfig.OssConfig.BucketName, fileName)
-			log.Infof("图片保存成功，图片链接: %v", fileUrl)
-			ctx.Content = fileUrl
-		} else {
-			log.Error("图片保存失败")
-		}
-	}
+	saveMessageMedia(ctx, mediaOption{kind: mediaKindImage, label: "图片", download: ctx.GetFile, sourceMd5: data.Img.Md5})
 	ctx.Next()
 }
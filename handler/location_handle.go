@@ -0,0 +1,79 @@
+package handler
+
+import (
+	"encoding/xml"
+	"fmt"
+	"gitee.ltd/lxh/logger/log"
+	"github.com/eatmoreapple/openwechat"
+	"html"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// LocationMessageData 位置消息结构体
+type LocationMessageData struct {
+	Latitude  float64 `xml:"x,attr" bson:"latitude" json:"latitude"`                          // 纬度
+	Longitude float64 `xml:"y,attr" bson:"longitude" json:"longitude"`                        // 经度
+	Scale     int     `xml:"scale,attr" bson:"scale,omitempty" json:"scale,omitempty"`        // 地图缩放级别
+	Label     string  `xml:"label,attr" bson:"label" json:"label"`                            // 详细地址
+	PoiName   string  `xml:"poiname,attr" bson:"poiName,omitempty" json:"poi_name,omitempty"` // 地点名称
+	PoiId     string  `xml:"poiid,attr" bson:"poiId,omitempty" json:"poi_id,omitempty"`       // 地点ID
+	Url       string  `xml:"-" bson:"url,omitempty" json:"url,omitempty"`                     // 地图链接
+}
+
+// 检查是否是位置消息，位置消息的类型是文本，通过子类型区分
+func checkIsLocation(message *openwechat.Message) bool {
+	return message.MsgType == openwechat.MsgTypeText && message.Url != "" &&
+		(message.SubMsgType == int(openwechat.MsgTypeLocation) || message.IsLocation())
+}
+
+// 位置消息处理
+func locationMessageHandle(ctx *openwechat.MessageContext) {
+	sender, _ := ctx.Sender()
+	senderUser := sender.NickName
+	if ctx.IsSendByGroup() {
+		// 取出消息在群里面的发送者
+		senderInGroup, _ := ctx.SenderInGroup()
+		senderUser = fmt.Sprintf("%v[%v]", senderInGroup.NickName, senderUser)
+	}
+	data := parseLocation(ctx.OriContent, ctx.Url)
+	if data == nil {
+		log.Errorf("位置消息解析失败")
+		log.Debugf("发信人: %v ==> 原始内容: %v", senderUser, ctx.OriContent)
+		return
+	}
+	ctx.Set(messageDataKey, data)
+	log.Infof("[收到新位置消息] == 发信人：%v ==> 位置：%v(%v,%v)", senderUser, data.Label, data.Latitude, data.Longitude)
+	ctx.Next()
+}
+
+// 解析位置信息，优先解析原始XML，解析不到的时候从地图链接里面取坐标
+func parseLocation(oriContent, mapUrl string) *LocationMessageData {
+	var msg struct {
+		Location LocationMessageData `xml:"location"`
+	}
+	content := strings.ReplaceAll(html.UnescapeString(oriContent), "<br/>", "\n")
+	content = strings.TrimSpace(content)
+	if err := xml.Unmarshal([]byte(content), &msg); err == nil && msg.Location.Label != "" {
+		msg.Location.Url = mapUrl
+		return &msg.Location
+	}
+	// 地图链接格式为 https://apis.map.qq.com/uri/v1/geocoder?coord=纬度,经度
+	u, err := url.Parse(mapUrl)
+	if err != nil {
+		return nil
+	}
+	coord := strings.Split(u.Query().Get("coord"), ",")
+	if len(coord) != 2 {
+		return nil
+	}
+	data := LocationMessageData{Url: mapUrl}
+	if data.Latitude, err = strconv.ParseFloat(coord[0], 64); err != nil {
+		return nil
+	}
+	if data.Longitude, err = strconv.ParseFloat(coord[1], 64); err != nil {
+		return nil
+	}
+	return &data
+}
@@ -0,0 +1,26 @@
+package handler
+
+import "testing"
+
+func TestParseLocation(t *testing.T) {
+	mapUrl := "https://apis.map.qq.com/uri/v1/geocoder?coord=22.543099,114.057868"
+	// 网页版的原始内容是转义过的XML，前面带着发信人和<br/>
+	oriContent := `wxid_sender:<br/>&lt;?xml version="1.0"?&gt;<br/>&lt;msg&gt;<br/>	&lt;location x="22.543099" y="114.057868" scale="16" label="广东省深圳市福田区深南大道" maptype="0" poiname="市民中心" poiid="123456" /&gt;<br/>&lt;/msg&gt;<br/>`
+	cases := []struct {
+		name       string
+		oriContent string
+		mapUrl     string
+		want       *LocationMessageData
+	}{
+		{"原始XML", oriContent, mapUrl, &LocationMessageData{Latitude: 22.543099, Longitude: 114.057868, Scale: 16, Label: "广东省深圳市福田区深南大道", PoiName: "市民中心", PoiId: "123456", Url: mapUrl}},
+		{"地图链接", "", mapUrl, &LocationMessageData{Latitude: 22.543099, Longitude: 114.057868, Url: mapUrl}},
+		{"坐标格式错误", "", "https://apis.map.qq.com/uri/v1/geocoder?coord=abc,114.057868", nil},
+		{"没有坐标", "", "https://apis.map.qq.com/uri/v1/geocoder", nil},
+	}
+	for _, c := range cases {
+		got := parseLocation(c.oriContent, c.mapUrl)
+		if (got == nil) != (c.want == nil) || (got != nil && *got != *c.want) {
+			t.Fatalf("%v: 解析结果错误: %+v", c.name, got)
+		}
+	}
+}
@@ -0,0 +1,288 @@
+package handler
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"gitee.ltd/lxh/logger/log"
+	"github.com/eatmoreapple/openwechat"
+	"go.mongodb.org/mongo-driver/bson"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+	"web-wechat/core"
+	"web-wechat/oss"
+)
+
+// 保存媒体信息用的消息上下文Key
+const (
+	mediaRecordKey = "mediaRecord"
+	mediaStatusKey = "mediaStatus"
+)
+
+// 媒体文件的保存状态
+const (
+	mediaStatusSaved   = "saved"   // 已保存
+	mediaStatusPending = "pending" // 保存失败，等待重试
+	mediaStatusFailed  = "failed"  // 保存失败，不再重试
+	mediaStatusExpired = "expired" // 超过保留时间，文件已清理
+)
+
+// MediaRecord 消息的媒体文件信息，媒体处理器保存文件之后写入消息上下文，原始消息内容保持不变
+type MediaRecord struct {
+	Key         string `bson:"key" json:"key"`                                      // OSS里的文件名
+	Url         string `bson:"url" json:"url"`                                      // 文件链接
+	Md5         string `bson:"md5" json:"md5"`                                      // 文件MD5
+	Size        int64  `bson:"size" json:"size"`                                    // 文件大小(字节)
+	ContentType string `bson:"contentType" json:"content_type"`                     // 文件类型
+	Width       int    `bson:"width,omitempty" json:"width,omitempty"`              // 图片宽度
+	Height      int    `bson:"height,omitempty" json:"height,omitempty"`            // 图片高度
+	ThumbKey    string `bson:"thumbKey,omitempty" json:"thumb_key,omitempty"`       // 缩略图文件名
+	ThumbUrl    string `bson:"thumbUrl,omitempty" json:"thumb_url,omitempty"`       // 缩略图链接
+	ThumbWidth  int    `bson:"thumbWidth,omitempty" json:"thumb_width,omitempty"`   // 缩略图宽度
+	ThumbHeight int    `bson:"thumbHeight,omitempty" json:"thumb_height,omitempty"` // 缩略图高度
+}
+
+// 取出消息上下文里的媒体信息
+func getMediaRecord(ctx *openwechat.MessageContext) *MediaRecord {
+	value, exist := ctx.Get(mediaRecordKey)
+	if !exist {
+		return nil
+	}
+	record, _ := value.(*MediaRecord)
+	return record
+}
+
+// 是否通过接口访问文件
+func mediaProxied() bool {
+	return core.SystemConfig.MediaConfig.ProxyUrl != ""
+}
+
+// 通过接口访问文件的链接，thumb为true的时候获取缩略图
+func mediaProxyUrl(msgId string, thumb bool) string {
+	u := strings.TrimRight(core.SystemConfig.MediaConfig.ProxyUrl, "/") + "/media/" + url.PathEscape(msgId)
+	if thumb {
+		u += "?thumb=true"
+	}
+	return u
+}
+
+// 取出消息上下文里的媒体保存状态
+func getMediaStatus(ctx *openwechat.MessageContext) string {
+	value, _ := ctx.Get(mediaStatusKey)
+	status, _ := value.(string)
+	return status
+}
+
+// 媒体文件类型，对应配置里的大小限制
+const (
+	mediaKindImage    = "image"
+	mediaKindEmoticon = "emoticon"
+	mediaKindVoice    = "voice"
+	mediaKindVideo    = "video"
+	mediaKindFile     = "file"
+)
+
+// 识别文件类型需要的文件头长度
+const sniffLen = 512
+
+// 读取图片尺寸预读的文件头长度，JPEG的尺寸信息可能在EXIF后面
+const headLen = 64 * 1024
+
+// 文件超过大小限制
+var errMediaTooLarge = errors.New("文件超过大小限制")
+
+// 媒体文件下载参数
+type mediaOption struct {
+	kind        string                         // 媒体类型
+	label       string                         // 日志里显示的媒体名称，比如图片、视频
+	download    func() (*http.Response, error) // 下载方法
+	sourceMd5   string                         // 消息里带的文件MD5，保存过的文件不重新下载
+	poster      func() (*http.Response, error) // 视频封面的下载方法，用来生成缩略图
+	defaultType string                         // 识别不出文件类型的时候使用的类型
+	capture     io.Writer                      // 上传的同时写一份文件内容，比如语音识别需要，不用再从OSS读取
+}
+
+// 下载消息的媒体文件并保存到OSS，保存成功后把媒体信息写入消息上下文
+// 下载或者上传失败的时候消息照常保存，媒体状态标记为等待重试，由重试任务重新下载
+func saveMessageMedia(ctx *openwechat.MessageContext, opt mediaOption) *MediaRecord {
+	var uin int64
+	if user, err := ctx.Bot().GetCurrentUser(); err == nil {
+		uin = user.Uin
+	}
+	record, err := storeMedia(uin, ctx.MsgId, opt)
+	if err == nil {
+		ctx.Set(mediaRecordKey, record)
+		ctx.Set(mediaStatusKey, mediaStatusSaved)
+		return record
+	}
+	log.Errorf("%v保存失败: %v", opt.label, err.Error())
+	if errors.Is(err, errMediaTooLarge) {
+		ctx.Set(mediaStatusKey, mediaStatusFailed)
+		return nil
+	}
+	appKey := core.AppKeyFromContext(ctx.Bot().Context())
+	if enqueueMediaRetry(appKey, uin, ctx.Message, opt, err) {
+		ctx.Set(mediaStatusKey, mediaStatusPending)
+	} else {
+		ctx.Set(mediaStatusKey, mediaStatusFailed)
+	}
+	return nil
+}
+
+// 下载媒体文件并保存到OSS，文件按内容MD5保存，相同内容只保存一份
+// 文件边下载边上传，不会整个读到内存里
+func storeMedia(uin int64, msgId string, opt mediaOption) (*MediaRecord, error) {
+	sourceMd5 := mediaSourceMd5(opt.kind, opt.sourceMd5)
+	// 已经保存过相同的文件，不需要重新下载
+	if sourceMd5 != "" {
+		if blob := findMediaBlob(bson.M{"sourceMd5": sourceMd5}); blob != nil {
+			// 文件刚好在被清理的时候重新下载
+			if record, err := useMediaBlob(uin, msgId, opt, blob); err == nil {
+				log.Infof("%v已经保存过，直接使用: %v", opt.label, blob.Key)
+				return record, nil
+			}
+		}
+	}
+
+	fileResp, err := opt.download()
+	if err != nil {
+		return nil, fmt.Errorf("下载失败: %w", err)
+	}
+	defer fileResp.Body.Close()
+	if fileResp.StatusCode < 200 || fileResp.StatusCode >= 300 {
+		return nil, fmt.Errorf("下载失败: %v", fileResp.Status)
+	}
+	maxSize := mediaMaxSize(opt.kind)
+	if maxSize > 0 && fileResp.ContentLength > maxSize {
+		return nil, fmt.Errorf("大小%v字节超过限制%v字节: %w", fileResp.ContentLength, maxSize, errMediaTooLarge)
+	}
+
+	// 预读文件头识别文件类型
+	body := bufio.NewReaderSize(fileResp.Body, headLen)
+	head, err := body.Peek(headLen)
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		return nil, fmt.Errorf("读取错误: %w", err)
+	}
+	sniff := head
+	if len(sniff) > sniffLen {
+		sniff = sniff[:sniffLen]
+	}
+	contentType := http.DetectContentType(sniff)
+	if contentType == "application/octet-stream" && opt.defaultType != "" {
+		contentType = opt.defaultType
+	}
+	blob := mediaBlob{ContentType: contentType, CreateTime: time.Now()}
+	if strings.HasPrefix(contentType, "image/") {
+		if conf, _, err := image.DecodeConfig(bytes.NewReader(head)); err == nil {
+			blob.Width, blob.Height = conf.Width, conf.Height
+		}
+	}
+
+	// 上传完才知道MD5，先上传到临时文件
+	tmpKey := fmt.Sprintf("tmp/%v/%v", uin, msgId)
+	var reader io.Reader = body
+	if opt.capture != nil {
+		reader = io.TeeReader(body, opt.capture)
+	}
+	if blob.Md5, blob.Size, err = uploadMedia(reader, fileResp.ContentLength, maxSize, contentType, tmpKey); err != nil {
+		return nil, err
+	}
+	blob.Key = mediaBlobKey(blob.Md5, contentType)
+
+	// 相同内容的文件已经存在的时候删掉临时文件，否则移动到正式的文件名
+	// 文件正在被清理的时候引用会失败，由重试任务等清理完成之后重新保存
+	if exist := findMediaBlob(bson.M{"_id": blob.Key}); exist != nil {
+		if err = oss.DeleteFromOss(tmpKey); err != nil {
+			log.Errorf("临时文件删除失败: %v", err.Error())
+		}
+		blob = *exist
+	} else if err = oss.MoveInOss(tmpKey, blob.Key); err != nil {
+		return nil, fmt.Errorf("移动临时文件失败: %w", err)
+	}
+	saveMediaBlob(&blob, sourceMd5)
+	record, err := useMediaBlob(uin, msgId, opt, &blob)
+	if err != nil {
+		return nil, fmt.Errorf("引用文件失败: %w", err)
+	}
+	log.Infof("%v保存成功，文件: %v", opt.label, blob.Key)
+	return record, nil
+}
+
+// 边读边算MD5上传文件，返回MD5和文件大小，超过大小限制的时候中断上传
+// 文件大小已知的时候传给OSS，未知的时候OSS按固定大小分片上传
+func uploadMedia(body io.Reader, contentLength, maxSize int64, contentType, key string) (string, int64, error) {
+	size := contentLength
+	if size <= 0 {
+		size = -1
+	}
+	hash := md5.New()
+	reader := &mediaReader{r: io.TeeReader(body, hash), limit: maxSize}
+	if !oss.SaveToOss(reader, size, contentType, key) {
+		if reader.exceeded {
+			return "", 0, fmt.Errorf("超过大小限制%v字节: %w", maxSize, errMediaTooLarge)
+		}
+		return "", 0, errors.New("上传到OSS失败")
+	}
+	return hex.EncodeToString(hash.Sum(nil)), reader.size, nil
+}
+
+// 记录消息引用的文件，还没有缩略图的时候生成缩略图
+func useMediaBlob(uin int64, msgId string, opt mediaOption, blob *mediaBlob) (*MediaRecord, error) {
+	if err := saveMediaRef(uin, msgId, opt.kind, blob.Key); err != nil {
+		return nil, err
+	}
+	if blob.ThumbKey == "" {
+		saveMediaThumb(blob, opt)
+	}
+	return blob.record(), nil
+}
+
+// 获取媒体类型的大小限制(字节)，没有配置返回0
+func mediaMaxSize(kind string) int64 {
+	return core.SystemConfig.MediaConfig.MaxSize[kind] * 1024 * 1024
+}
+
+// 统计读取的大小，超过限制返回错误
+type mediaReader struct {
+	r        io.Reader
+	limit    int64 // 大小限制，0为不限制
+	size     int64 // 已读取的大小
+	exceeded bool  // 是否超过了限制
+}
+
+func (m *mediaReader) Read(p []byte) (int, error) {
+	n, err := m.r.Read(p)
+	m.size += int64(n)
+	if m.limit > 0 && m.size > m.limit {
+		m.exceeded = true
+		return n, errMediaTooLarge
+	}
+	return n, err
+}
+
+// 扩展名和类型名称不一样的文件类型
+var mediaExtMap = map[string]string{
+	"audio/mpeg": "mp3",
+}
+
+// 根据文件类型取扩展名，image/jpeg取jpeg
+func mediaExt(contentType string) string {
+	ext := strings.Split(contentType, ";")[0]
+	if v, ok := mediaExtMap[ext]; ok {
+		return v
+	}
+	if i := strings.Index(ext, "/"); i >= 0 {
+		ext = ext[i+1:]
+	}
+	return ext
+}
@@ -0,0 +1,220 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"gitee.ltd/lxh/logger/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"strings"
+	"time"
+	. "web-wechat/db"
+	"web-wechat/oss"
+)
+
+// 媒体文件相关的表名
+const (
+	MediaBlobTableName = "media_blob" // 按内容去重之后的文件
+	MediaRefTableName  = "media_ref"  // 消息和文件的对应关系
+)
+
+// 按内容去重之后的文件，同样内容的文件只保存一份
+type mediaBlob struct {
+	Key         string    `bson:"_id"`                   // OSS里的文件名
+	Md5         string    `bson:"md5"`                   // 文件内容的MD5
+	SourceMd5   []string  `bson:"sourceMd5,omitempty"`   // 消息里带的MD5，格式为 媒体类型:MD5，命中的时候不需要重新下载
+	Size        int64     `bson:"size"`                  // 文件大小(字节)
+	ContentType string    `bson:"contentType"`           // 文件类型
+	Width       int       `bson:"width,omitempty"`       // 图片宽度
+	Height      int       `bson:"height,omitempty"`      // 图片高度
+	ThumbKey    string    `bson:"thumbKey,omitempty"`    // 缩略图文件名
+	ThumbWidth  int       `bson:"thumbWidth,omitempty"`  // 缩略图宽度
+	ThumbHeight int       `bson:"thumbHeight,omitempty"` // 缩略图高度
+	Refs        int64     `bson:"refs"`                  // 引用这个文件的消息数量，为0的时候可以清理
+	Deleting    bool      `bson:"deleting,omitempty"`    // 正在清理，不能再被引用
+	CreateTime  time.Time `bson:"createTime"`            // 第一次保存的时间
+}
+
+// 消息引用的文件
+type mediaRef struct {
+	Uin        int64     `bson:"uin"`        // 消息所属的登录用户
+	MsgId      string    `bson:"msgId"`      // 消息ID
+	Kind       string    `bson:"kind"`       // 媒体类型
+	Key        string    `bson:"key"`        // 文件名
+	CreateTime time.Time `bson:"createTime"` // 引用时间
+}
+
+// 文件正在被清理，稍后重新下载
+var errMediaBlobDeleting = errors.New("文件正在被清理")
+
+// 文件记录不存在
+var errMediaBlobMissing = errors.New("文件记录不存在")
+
+// 文件和引用记录的读写，引用计数的增减和清理的加锁都是原子操作，测试的时候可以换成内存实现
+type mediaIndex interface {
+	acquireBlob(key string) error               // 引用计数加一，文件正在清理的时候返回errMediaBlobDeleting
+	releaseBlob(key string)                     // 引用计数减一
+	addRef(ref mediaRef) bool                   // 保存引用，已经存在的时候返回false
+	removeRef(ref mediaRef) bool                // 删除引用，不存在的时候返回false
+	lockBlob(key string) *mediaBlob             // 没有引用的时候标记为正在清理，返回文件记录，还有引用的时候返回nil
+	unlockBlob(key string)                      // 清理失败的时候取消标记
+	deleteBlob(key string)                      // 删除文件记录
+	expireMessage(uin int64, msgId string) bool // 把消息的媒体标记为已过期
+}
+
+// 当前使用的文件记录存储
+var mediaDb mediaIndex = mongoMediaIndex{}
+
+// InitMediaIndex 初始化媒体文件表索引
+func InitMediaIndex() {
+	blobModels := []mongo.IndexModel{
+		{Keys: bson.D{{Key: "md5", Value: 1}}},
+		{Keys: bson.D{{Key: "sourceMd5", Value: 1}}},
+	}
+	if err := MongoClient.CreateIndexes(MediaBlobTableName, blobModels); err != nil {
+		log.Errorf("媒体文件表索引初始化失败: %v", err.Error())
+	}
+	refModels := []mongo.IndexModel{
+		{Keys: bson.D{{Key: "uin", Value: 1}, {Key: "msgId", Value: 1}}},
+		{Keys: bson.D{{Key: "key", Value: 1}}},
+		{Keys: bson.D{{Key: "kind", Value: 1}, {Key: "createTime", Value: 1}}},
+	}
+	if err := MongoClient.CreateIndexes(MediaRefTableName, refModels); err != nil {
+		log.Errorf("媒体引用表索引初始化失败: %v", err.Error())
+	}
+}
+
+// 按内容MD5生成文件名，前两位作为目录避免单个目录文件过多
+func mediaBlobKey(md5, contentType string) string {
+	return fmt.Sprintf("blob/%v/%v.%v", md5[:2], md5, mediaExt(contentType))
+}
+
+// 消息里带的MD5加上媒体类型，不同类型下载下来的文件不一样
+func mediaSourceMd5(kind, md5 string) string {
+	if md5 == "" {
+		return ""
+	}
+	return kind + ":" + strings.ToLower(md5)
+}
+
+// 查询已经保存过的文件
+func findMediaBlob(filter bson.M) *mediaBlob {
+	var list []mediaBlob
+	if err := MongoClient.Find(filter, options.Find().SetLimit(1), MediaBlobTableName, &list); err != nil {
+		log.Errorf("查询媒体文件失败: %v", err.Error())
+		return nil
+	}
+	if len(list) == 0 {
+		return nil
+	}
+	return &list[0]
+}
+
+// 保存文件记录，已经存在的时候只补充消息里带的MD5
+func saveMediaBlob(blob *mediaBlob, sourceMd5 string) {
+	sourceList := blob.SourceMd5
+	blob.SourceMd5 = nil
+	update := bson.M{"$setOnInsert": blob}
+	if sourceMd5 != "" {
+		update["$addToSet"] = bson.M{"sourceMd5": sourceMd5}
+	}
+	MongoClient.Upsert(bson.M{"_id": blob.Key}, update, MediaBlobTableName)
+	blob.SourceMd5 = sourceList
+}
+
+// 保存消息引用的文件，引用计数加一，文件正在清理的时候返回错误
+func saveMediaRef(uin int64, msgId, kind, key string) error {
+	if err := mediaDb.acquireBlob(key); err != nil {
+		return err
+	}
+	// 重试的时候引用可能已经存在，不重复计数
+	if !mediaDb.addRef(mediaRef{Uin: uin, MsgId: msgId, Kind: kind, Key: key, CreateTime: time.Now()}) {
+		mediaDb.releaseBlob(key)
+	}
+	return nil
+}
+
+// MongoDB里的文件和引用记录
+type mongoMediaIndex struct{}
+
+func (mongoMediaIndex) acquireBlob(key string) error {
+	count, err := MongoClient.UpdateCount(bson.M{"_id": key, "deleting": bson.M{"$ne": true}}, bson.M{"$inc": bson.M{"refs": 1}}, MediaBlobTableName)
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+	if findMediaBlob(bson.M{"_id": key}) != nil {
+		return errMediaBlobDeleting
+	}
+	return errMediaBlobMissing
+}
+
+func (mongoMediaIndex) releaseBlob(key string) {
+	MongoClient.Update(bson.M{"_id": key}, bson.M{"$inc": bson.M{"refs": -1}}, MediaBlobTableName)
+}
+
+func (mongoMediaIndex) addRef(ref mediaRef) bool {
+	count, err := MongoClient.UpsertCount(bson.M{"uin": ref.Uin, "msgId": ref.MsgId, "key": ref.Key}, bson.M{"$setOnInsert": ref}, MediaRefTableName)
+	return err == nil && count > 0
+}
+
+func (mongoMediaIndex) removeRef(ref mediaRef) bool {
+	count, err := MongoClient.DeleteOne(bson.M{"uin": ref.Uin, "msgId": ref.MsgId, "key": ref.Key}, MediaRefTableName)
+	return err == nil && count > 0
+}
+
+func (mongoMediaIndex) lockBlob(key string) *mediaBlob {
+	var blob mediaBlob
+	filter := bson.M{"_id": key, "refs": bson.M{"$lte": 0}, "deleting": bson.M{"$ne": true}}
+	if err := MongoClient.FindOneAndUpdate(filter, bson.M{"$set": bson.M{"deleting": true}}, MediaBlobTableName, &blob); err != nil {
+		if !errors.Is(err, mongo.ErrNoDocuments) {
+			log.Errorf("标记文件清理失败: %v", err.Error())
+		}
+		return nil
+	}
+	return &blob
+}
+
+func (mongoMediaIndex) unlockBlob(key string) {
+	MongoClient.Update(bson.M{"_id": key}, bson.M{"$unset": bson.M{"deleting": ""}}, MediaBlobTableName)
+}
+
+func (mongoMediaIndex) deleteBlob(key string) {
+	MongoClient.Delete(bson.M{"_id": key}, MediaBlobTableName)
+}
+
+func (mongoMediaIndex) expireMessage(uin int64, msgId string) bool {
+	update := bson.M{
+		"$set":   bson.M{"mediaStatus": mediaStatusExpired, "mediaUrl": ""},
+		"$unset": bson.M{"media.url": "", "media.thumbUrl": ""},
+	}
+	return MongoClient.Update(bson.M{"uin": uin, "msgId": msgId}, update, MessageTableName)
+}
+
+// 缩略图链接，没有缩略图的时候返回空
+func thumbUrl(key string) string {
+	if key == "" {
+		return ""
+	}
+	return oss.GetUrl(key)
+}
+
+// 转换为消息里的媒体信息
+func (b *mediaBlob) record() *MediaRecord {
+	return &MediaRecord{
+		Key:         b.Key,
+		Url:         oss.GetUrl(b.Key),
+		Md5:         b.Md5,
+		Size:        b.Size,
+		ContentType: b.ContentType,
+		Width:       b.Width,
+		Height:      b.Height,
+		ThumbKey:    b.ThumbKey,
+		ThumbUrl:    thumbUrl(b.ThumbKey),
+		ThumbWidth:  b.ThumbWidth,
+		ThumbHeight: b.ThumbHeight,
+	}
+}
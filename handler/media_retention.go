@@ -0,0 +1,229 @@
+package handler
+
+import (
+	"errors"
+	"gitee.ltd/lxh/logger/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"sort"
+	"strconv"
+	"time"
+	"web-wechat/core"
+	. "web-wechat/db"
+	"web-wechat/oss"
+)
+
+// 每批清理的引用数量
+const mediaRetentionBatch = 500
+
+// MediaRetentionRule 一条保留规则和命中的消息数量
+type MediaRetentionRule struct {
+	Uin      int64     `json:"uin,omitempty"` // 单独配置的登录用户，默认规则为空
+	Kind     string    `json:"kind"`          // 媒体类型
+	Days     int       `json:"days"`          // 保留天数
+	Before   time.Time `json:"before"`        // 早于这个时间保存的文件会被清理
+	Messages int       `json:"messages"`      // 媒体过期的消息数量
+
+	filter bson.M // 查询过期引用的条件
+}
+
+// MediaRetentionReport 媒体文件清理结果，预览的时候是会被清理的内容
+type MediaRetentionReport struct {
+	DryRun   bool                 `json:"dry_run"`  // 是否只是预览
+	Rules    []MediaRetentionRule `json:"rules"`    // 命中的规则
+	Messages int                  `json:"messages"` // 媒体过期的消息数量
+	Blobs    int                  `json:"blobs"`    // 删除的文件数量，还有其他消息引用的文件不删除
+	Bytes    int64                `json:"bytes"`    // 释放的空间(字节)
+}
+
+// 按配置生成保留规则，scope不为0的时候只生成指定登录用户的规则
+// 单独配置了某个类型的用户不使用这个类型的默认规则，保留天数为0表示永久保留
+func mediaRetentionRules(scope int64, now time.Time) []MediaRetentionRule {
+	conf := core.SystemConfig.MediaConfig.Retention
+	accounts := make(map[int64]map[string]int)
+	for key, days := range conf.Accounts {
+		uin, err := strconv.ParseInt(key, 10, 64)
+		if err != nil {
+			log.Errorf("媒体保留配置的用户Uin格式错误: %v", key)
+			continue
+		}
+		accounts[uin] = days
+	}
+
+	var rules []MediaRetentionRule
+	for kind, days := range conf.Days {
+		if days <= 0 {
+			continue
+		}
+		var excluded []int64
+		for uin, kinds := range accounts {
+			if _, ok := kinds[kind]; ok {
+				excluded = append(excluded, uin)
+			}
+		}
+		rule := MediaRetentionRule{Kind: kind, Days: days, Before: now.AddDate(0, 0, -days)}
+		rule.filter = bson.M{"kind": kind, "createTime": bson.M{"$lt": rule.Before}}
+		if scope != 0 {
+			if containsUin(excluded, scope) {
+				continue
+			}
+			rule.filter["uin"] = scope
+		} else if len(excluded) > 0 {
+			rule.filter["uin"] = bson.M{"$nin": excluded}
+		}
+		rules = append(rules, rule)
+	}
+	for uin, kinds := range accounts {
+		if scope != 0 && uin != scope {
+			continue
+		}
+		for kind, days := range kinds {
+			if days <= 0 {
+				continue
+			}
+			rule := MediaRetentionRule{Uin: uin, Kind: kind, Days: days, Before: now.AddDate(0, 0, -days)}
+			rule.filter = bson.M{"uin": uin, "kind": kind, "createTime": bson.M{"$lt": rule.Before}}
+			rules = append(rules, rule)
+		}
+	}
+	// 配置是map，排序之后结果稳定
+	sort.Slice(rules, func(i, j int) bool {
+		if rules[i].Uin != rules[j].Uin {
+			return rules[i].Uin < rules[j].Uin
+		}
+		return rules[i].Kind < rules[j].Kind
+	})
+	return rules
+}
+
+func containsUin(list []int64, uin int64) bool {
+	for _, v := range list {
+		if v == uin {
+			return true
+		}
+	}
+	return false
+}
+
+// StartMediaJanitor 启动过期媒体文件的定时清理
+func StartMediaJanitor() {
+	conf := core.SystemConfig.MediaConfig.Retention
+	if !conf.Enable {
+		return
+	}
+	interval := time.Duration(conf.Interval) * time.Hour
+	if interval <= 0 {
+		interval = 24 * time.Hour
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			report := CleanExpiredMedia()
+			log.Infof("过期媒体文件清理完成，消息: %v，删除文件: %v，释放空间: %v字节", report.Messages, report.Blobs, report.Bytes)
+			<-ticker.C
+		}
+	}()
+}
+
+// CleanExpiredMedia 清理过期的媒体文件，消息标记为媒体已过期，没有其他消息引用的文件从OSS删除
+func CleanExpiredMedia() *MediaRetentionReport {
+	report := &MediaRetentionReport{}
+	for _, rule := range mediaRetentionRules(0, time.Now()) {
+		for {
+			var refs []mediaRef
+			if err := MongoClient.Find(rule.filter, options.Find().SetLimit(mediaRetentionBatch), MediaRefTableName, &refs); err != nil {
+				log.Errorf("查询过期媒体引用失败: %v", err.Error())
+				break
+			}
+			removed := 0
+			for _, ref := range refs {
+				if !expireMediaRef(ref, report) {
+					continue
+				}
+				removed++
+				rule.Messages++
+			}
+			// 一条都没删掉的时候不再继续，避免一直查到同样的数据
+			if len(refs) < mediaRetentionBatch || removed == 0 {
+				break
+			}
+		}
+		report.Messages += rule.Messages
+		report.Rules = append(report.Rules, rule)
+	}
+	return report
+}
+
+// 让一条引用过期，文件没有其他引用的时候删除文件
+// 删除之前先原子地把没有引用的文件标记为正在清理，同时保存的消息不会再引用这个文件
+func expireMediaRef(ref mediaRef, report *MediaRetentionReport) bool {
+	if !mediaDb.expireMessage(ref.Uin, ref.MsgId) {
+		return false
+	}
+	if !mediaDb.removeRef(ref) {
+		return false
+	}
+	mediaDb.releaseBlob(ref.Key)
+
+	blob := mediaDb.lockBlob(ref.Key)
+	if blob == nil {
+		return true
+	}
+	if err := oss.DeleteFromOss(ref.Key); err != nil && !errors.Is(err, oss.ErrNotFound) {
+		log.Errorf("过期媒体文件删除失败: %v", err.Error())
+		mediaDb.unlockBlob(ref.Key)
+		return true
+	}
+	if blob.ThumbKey != "" {
+		if err := oss.DeleteFromOss(blob.ThumbKey); err != nil && !errors.Is(err, oss.ErrNotFound) {
+			log.Errorf("过期缩略图删除失败: %v", err.Error())
+		}
+	}
+	mediaDb.deleteBlob(ref.Key)
+	report.Blobs++
+	report.Bytes += blob.Size
+	return true
+}
+
+// MediaRetentionDryRun 预览指定登录用户会被清理的媒体文件，不做任何修改
+// 只做统计，不把引用读到内存里
+func MediaRetentionDryRun(uin int64) (*MediaRetentionReport, error) {
+	report := &MediaRetentionReport{DryRun: true}
+	var filters []bson.M
+	for _, rule := range mediaRetentionRules(uin, time.Now()) {
+		count, err := MongoClient.Count(rule.filter, MediaRefTableName)
+		if err != nil {
+			return nil, err
+		}
+		rule.Messages = int(count)
+		report.Messages += rule.Messages
+		report.Rules = append(report.Rules, rule)
+		filters = append(filters, rule.filter)
+	}
+	if len(filters) == 0 {
+		return report, nil
+	}
+
+	// 按文件统计会过期的引用数量，所有引用都过期的文件才会被删除，文件的引用计数就是引用总数
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"$or": filters}}},
+		{{Key: "$group", Value: bson.M{"_id": "$key", "expiring": bson.M{"$sum": 1}}}},
+		{{Key: "$lookup", Value: bson.M{"from": MediaBlobTableName, "localField": "_id", "foreignField": "_id", "as": "blob"}}},
+		{{Key: "$unwind", Value: "$blob"}},
+		{{Key: "$match", Value: bson.M{"$expr": bson.M{"$gte": bson.A{"$expiring", "$blob.refs"}}}}},
+		{{Key: "$group", Value: bson.M{"_id": nil, "blobs": bson.M{"$sum": 1}, "bytes": bson.M{"$sum": "$blob.size"}}}},
+	}
+	var result []struct {
+		Blobs int   `bson:"blobs"`
+		Bytes int64 `bson:"bytes"`
+	}
+	if err := MongoClient.Aggregate(pipeline, MediaRefTableName, &result); err != nil {
+		return nil, err
+	}
+	if len(result) > 0 {
+		report.Blobs, report.Bytes = result[0].Blobs, result[0].Bytes
+	}
+	return report, nil
+}
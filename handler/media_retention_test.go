@@ -0,0 +1,206 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
+	"strings"
+	"testing"
+	"time"
+	"web-wechat/core"
+	"web-wechat/oss"
+)
+
+func TestMediaRetentionRules(t *testing.T) {
+	old := core.SystemConfig.MediaConfig.Retention
+	defer func() { core.SystemConfig.MediaConfig.Retention = old }()
+	core.SystemConfig.MediaConfig.Retention.Days = map[string]int{"image": 365, "video": 90, "file": 0}
+	core.SystemConfig.MediaConfig.Retention.Accounts = map[string]map[string]int{
+		"100": {"video": 30},
+		"200": {"video": 0},
+	}
+	now := time.Date(2023, 6, 1, 0, 0, 0, 0, time.UTC)
+
+	rules := mediaRetentionRules(0, now)
+	if len(rules) != 3 {
+		t.Fatalf("应该有3条规则，实际: %+v", rules)
+	}
+	if rules[0].Kind != "image" || rules[1].Kind != "video" || rules[1].Uin != 0 || rules[2].Uin != 100 {
+		t.Fatalf("规则顺序错误: %+v", rules)
+	}
+	// 单独配置了视频的用户不使用默认的视频规则
+	nin, _ := rules[1].filter["uin"].(bson.M)
+	if excluded, _ := nin["$nin"].([]int64); len(excluded) != 2 {
+		t.Fatalf("默认视频规则应该排除单独配置的用户: %v", rules[1].filter)
+	}
+	if !rules[2].Before.Equal(now.AddDate(0, 0, -30)) {
+		t.Fatalf("保留时间错误: %v", rules[2].Before)
+	}
+
+	// 永久保留视频的用户只有图片规则
+	rules = mediaRetentionRules(200, now)
+	if len(rules) != 1 || rules[0].Kind != "image" || rules[0].filter["uin"] != int64(200) {
+		t.Fatalf("指定用户的规则错误: %+v", rules)
+	}
+}
+
+// 内存里的文件和引用记录
+type memoryMediaIndex struct {
+	blobs    map[string]*mediaBlob
+	refs     map[string]mediaRef
+	expired  []string
+	onRemove func() // 删除引用之后调用，用来模拟同时有新消息引用文件
+}
+
+func newMemoryMediaIndex() *memoryMediaIndex {
+	return &memoryMediaIndex{blobs: make(map[string]*mediaBlob), refs: make(map[string]mediaRef)}
+}
+
+func memoryRefKey(ref mediaRef) string {
+	return fmt.Sprintf("%v/%v/%v", ref.Uin, ref.MsgId, ref.Key)
+}
+
+func (m *memoryMediaIndex) acquireBlob(key string) error {
+	blob, ok := m.blobs[key]
+	if !ok {
+		return errMediaBlobMissing
+	}
+	if blob.Deleting {
+		return errMediaBlobDeleting
+	}
+	blob.Refs++
+	return nil
+}
+
+func (m *memoryMediaIndex) releaseBlob(key string) {
+	if blob, ok := m.blobs[key]; ok {
+		blob.Refs--
+	}
+}
+
+func (m *memoryMediaIndex) addRef(ref mediaRef) bool {
+	if _, ok := m.refs[memoryRefKey(ref)]; ok {
+		return false
+	}
+	m.refs[memoryRefKey(ref)] = ref
+	return true
+}
+
+func (m *memoryMediaIndex) removeRef(ref mediaRef) bool {
+	if _, ok := m.refs[memoryRefKey(ref)]; !ok {
+		return false
+	}
+	delete(m.refs, memoryRefKey(ref))
+	if m.onRemove != nil {
+		m.onRemove()
+	}
+	return true
+}
+
+func (m *memoryMediaIndex) lockBlob(key string) *mediaBlob {
+	blob, ok := m.blobs[key]
+	if !ok || blob.Refs > 0 || blob.Deleting {
+		return nil
+	}
+	blob.Deleting = true
+	locked := *blob
+	return &locked
+}
+
+func (m *memoryMediaIndex) unlockBlob(key string) {
+	if blob, ok := m.blobs[key]; ok {
+		blob.Deleting = false
+	}
+}
+
+func (m *memoryMediaIndex) deleteBlob(key string) {
+	delete(m.blobs, key)
+}
+
+func (m *memoryMediaIndex) expireMessage(uin int64, msgId string) bool {
+	m.expired = append(m.expired, msgId)
+	return true
+}
+
+func TestExpireMediaRef(t *testing.T) {
+	index := newMemoryMediaIndex()
+	old := mediaDb
+	mediaDb = index
+	defer func() { mediaDb = old }()
+	storage := oss.NewMemoryStorage()
+	oss.SetStorage(storage)
+	defer oss.SetStorage(nil)
+
+	ctx := context.Background()
+	key, thumbKey := "blob/5d/5d41402abc4b2a76b9719d911017c592.txt", "thumb/5d41402abc4b2a76b9719d911017c592.jpg"
+	_ = storage.Put(ctx, key, strings.NewReader("hello"), 5, "text/plain")
+	_ = storage.Put(ctx, thumbKey, strings.NewReader("thumb"), 5, "image/jpeg")
+	index.blobs[key] = &mediaBlob{Key: key, Size: 5, ThumbKey: thumbKey}
+	opt := mediaOption{kind: mediaKindFile}
+	for _, msgId := range []string{"1", "2"} {
+		if _, err := useMediaBlob(100, msgId, opt, index.blobs[key]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 重复保存同一条消息不重复计数
+	if _, err := useMediaBlob(100, "2", opt, index.blobs[key]); err != nil || index.blobs[key].Refs != 2 {
+		t.Fatalf("引用计数错误: %v, %v", index.blobs[key].Refs, err)
+	}
+
+	report := &MediaRetentionReport{}
+	if !expireMediaRef(mediaRef{Uin: 100, MsgId: "1", Key: key}, report) {
+		t.Fatal("引用应该过期")
+	}
+	if _, err := storage.Stat(ctx, key); err != nil || report.Blobs != 0 {
+		t.Fatalf("还有其他引用的文件不应该删除: %v, %+v", err, report)
+	}
+
+	// 删除最后一条引用之后、清理文件之前有新消息引用了这个文件
+	index.onRemove = func() {
+		index.onRemove = nil
+		if _, err := useMediaBlob(100, "3", opt, index.blobs[key]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !expireMediaRef(mediaRef{Uin: 100, MsgId: "2", Key: key}, report) {
+		t.Fatal("引用应该过期")
+	}
+	if _, err := storage.Stat(ctx, key); err != nil || report.Blobs != 0 || index.blobs[key] == nil {
+		t.Fatalf("被新消息引用的文件不应该删除: %v, %+v", err, report)
+	}
+
+	// 最后一条引用过期之后删除文件和缩略图
+	if !expireMediaRef(mediaRef{Uin: 100, MsgId: "3", Key: key}, report) {
+		t.Fatal("引用应该过期")
+	}
+	if _, err := storage.Stat(ctx, key); !errors.Is(err, oss.ErrNotFound) {
+		t.Fatalf("没有引用的文件应该删除: %v", err)
+	}
+	if _, err := storage.Stat(ctx, thumbKey); !errors.Is(err, oss.ErrNotFound) {
+		t.Fatalf("缩略图应该删除: %v", err)
+	}
+	if report.Blobs != 1 || report.Bytes != 5 || index.blobs[key] != nil || len(index.expired) != 3 {
+		t.Fatalf("清理结果错误: %+v, %v", report, index.expired)
+	}
+	// 已经删除的引用不重复处理
+	if expireMediaRef(mediaRef{Uin: 100, MsgId: "3", Key: key}, report) {
+		t.Fatal("不存在的引用不应该再次过期")
+	}
+}
+
+func TestUseDeletingMediaBlob(t *testing.T) {
+	index := newMemoryMediaIndex()
+	old := mediaDb
+	mediaDb = index
+	defer func() { mediaDb = old }()
+
+	key := "blob/5d/5d41402abc4b2a76b9719d911017c592.txt"
+	index.blobs[key] = &mediaBlob{Key: key, ThumbKey: "thumb", Deleting: true}
+	if _, err := useMediaBlob(100, "1", mediaOption{kind: mediaKindFile}, index.blobs[key]); !errors.Is(err, errMediaBlobDeleting) {
+		t.Fatalf("正在清理的文件不能被引用，实际: %v", err)
+	}
+	if len(index.refs) != 0 || index.blobs[key].Refs != 0 {
+		t.Fatalf("引用失败的时候不应该保存引用: %v, %v", index.refs, index.blobs[key].Refs)
+	}
+}
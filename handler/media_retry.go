@@ -0,0 +1,200 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gitee.ltd/lxh/logger/log"
+	"github.com/eatmoreapple/openwechat"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"net/http"
+	"time"
+	"web-wechat/core"
+	. "web-wechat/db"
+)
+
+// MediaRetryTableName 媒体文件下载重试队列表名
+const MediaRetryTableName = "media_retry"
+
+// 重试任务的状态
+const (
+	mediaRetryPending = "pending" // 等待重试
+	mediaRetryFailed  = "failed"  // 超过重试次数
+)
+
+// 每轮处理的任务数量
+const mediaRetryBatch = 20
+
+// 媒体文件下载重试任务，保存原始消息，重试的时候用原始消息重新下载
+type mediaRetry struct {
+	Id          string    `bson:"_id"`                   // 登录用户Uin:消息ID
+	AppKey      string    `bson:"appKey"`                // 重试的时候用来获取Bot
+	Uin         int64     `bson:"uin"`                   // 消息所属的登录用户
+	MsgId       string    `bson:"msgId"`                 // 消息ID
+	Kind        string    `bson:"kind"`                  // 媒体类型
+	Label       string    `bson:"label"`                 // 日志里显示的媒体名称
+	SourceMd5   string    `bson:"sourceMd5,omitempty"`   // 消息里带的文件MD5
+	DefaultType string    `bson:"defaultType,omitempty"` // 识别不出文件类型的时候使用的类型
+	Raw         string    `bson:"raw"`                   // 原始消息
+	Status      string    `bson:"status"`                // 任务状态
+	Attempts    int       `bson:"attempts"`              // 已经重试的次数
+	LastError   string    `bson:"lastError"`             // 最后一次失败的原因
+	NextTime    time.Time `bson:"nextTime"`              // 下一次重试的时间
+	CreateTime  time.Time `bson:"createTime"`            // 创建时间
+	UpdateTime  time.Time `bson:"updateTime"`            // 更新时间
+}
+
+// InitMediaRetryIndex 初始化重试队列表索引
+func InitMediaRetryIndex() {
+	models := []mongo.IndexModel{
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "nextTime", Value: 1}}},
+	}
+	if err := MongoClient.CreateIndexes(MediaRetryTableName, models); err != nil {
+		log.Errorf("媒体重试队列表索引初始化失败: %v", err.Error())
+	}
+}
+
+// 重试间隔
+func mediaRetryInterval() time.Duration {
+	if interval := core.SystemConfig.MediaConfig.Retry.Interval; interval > 0 {
+		return time.Duration(interval) * time.Second
+	}
+	return time.Minute
+}
+
+// 最多重试次数
+func mediaRetryMaxAttempts() int {
+	if attempts := core.SystemConfig.MediaConfig.Retry.MaxAttempts; attempts > 0 {
+		return attempts
+	}
+	return 5
+}
+
+// 第几次失败之后的重试间隔，每次翻倍
+func mediaRetryBackoff(attempts int) time.Duration {
+	if attempts > 10 {
+		attempts = 10
+	}
+	return mediaRetryInterval() << attempts
+}
+
+// 把下载失败的媒体文件加入重试队列
+func enqueueMediaRetry(appKey string, uin int64, msg *openwechat.Message, opt mediaOption, cause error) bool {
+	if appKey == "" || len(msg.Raw) == 0 {
+		return false
+	}
+	now := time.Now()
+	job := mediaRetry{
+		Id:          fmt.Sprintf("%v:%v", uin, msg.MsgId),
+		AppKey:      appKey,
+		Uin:         uin,
+		MsgId:       msg.MsgId,
+		Kind:        opt.kind,
+		Label:       opt.label,
+		SourceMd5:   opt.sourceMd5,
+		DefaultType: opt.defaultType,
+		Raw:         string(msg.Raw),
+		Status:      mediaRetryPending,
+		LastError:   cause.Error(),
+		NextTime:    now.Add(mediaRetryBackoff(0)),
+		CreateTime:  now,
+		UpdateTime:  now,
+	}
+	// 同一条消息已经在队列里的时候保留原来的任务
+	if !MongoClient.Upsert(bson.M{"_id": job.Id}, bson.M{"$setOnInsert": job}, MediaRetryTableName) {
+		return false
+	}
+	log.Infof("%v已加入重试队列，消息ID: %v", opt.label, msg.MsgId)
+	return true
+}
+
+// StartMediaRetry 启动媒体文件下载重试任务，getBot用来根据AppKey获取登录的Bot
+func StartMediaRetry(getBot func(appKey string) *openwechat.Bot) {
+	go func() {
+		ticker := time.NewTicker(mediaRetryInterval())
+		defer ticker.Stop()
+		for range ticker.C {
+			retryMedia(getBot)
+		}
+	}()
+}
+
+// 处理到期的重试任务
+func retryMedia(getBot func(appKey string) *openwechat.Bot) {
+	var jobs []mediaRetry
+	filter := bson.M{"status": mediaRetryPending, "nextTime": bson.M{"$lte": time.Now()}}
+	opts := options.Find().SetSort(bson.M{"nextTime": 1}).SetLimit(mediaRetryBatch)
+	if err := MongoClient.Find(filter, opts, MediaRetryTableName, &jobs); err != nil {
+		log.Errorf("查询媒体重试任务失败: %v", err.Error())
+		return
+	}
+	for _, job := range jobs {
+		bot := getBot(job.AppKey)
+		if bot == nil || !bot.Alive() {
+			// 微信不在线的时候不算重试次数，等下一轮
+			MongoClient.Update(bson.M{"_id": job.Id}, bson.M{"$set": bson.M{"nextTime": time.Now().Add(mediaRetryInterval())}}, MediaRetryTableName)
+			continue
+		}
+		job.run(bot)
+	}
+}
+
+// 执行一次重试，成功之后更新消息里的媒体信息
+func (j mediaRetry) run(bot *openwechat.Bot) {
+	var msg openwechat.Message
+	if err := json.Unmarshal([]byte(j.Raw), &msg); err != nil {
+		log.Errorf("重试任务的原始消息解析失败: %v", err.Error())
+		j.fail(err, true)
+		return
+	}
+	opt, err := retryMediaOption(bot, &msg, j)
+	if err != nil {
+		j.fail(err, true)
+		return
+	}
+	record, err := storeMedia(j.Uin, j.MsgId, opt)
+	if err != nil {
+		log.Errorf("%v重试保存失败: %v", j.Label, err.Error())
+		j.fail(err, errors.Is(err, errMediaTooLarge))
+		return
+	}
+	update := bson.M{"media": record, "mediaUrl": record.Url, "mediaStatus": mediaStatusSaved}
+	MongoClient.Update(bson.M{"uin": j.Uin, "msgId": j.MsgId}, bson.M{"$set": update}, MessageTableName)
+	MongoClient.Delete(bson.M{"_id": j.Id}, MediaRetryTableName)
+	log.Infof("%v重试保存成功，消息ID: %v", j.Label, j.MsgId)
+}
+
+// 记录失败，超过重试次数或者不能重试的时候把消息的媒体状态改为失败
+func (j mediaRetry) fail(cause error, permanent bool) {
+	attempts := j.Attempts + 1
+	now := time.Now()
+	set := bson.M{"attempts": attempts, "lastError": cause.Error(), "updateTime": now, "nextTime": now.Add(mediaRetryBackoff(attempts))}
+	if permanent || attempts >= mediaRetryMaxAttempts() {
+		set["status"] = mediaRetryFailed
+		MongoClient.Update(bson.M{"uin": j.Uin, "msgId": j.MsgId}, bson.M{"$set": bson.M{"mediaStatus": mediaStatusFailed}}, MessageTableName)
+		log.Errorf("%v保存失败，不再重试，消息ID: %v", j.Label, j.MsgId)
+	}
+	MongoClient.Update(bson.M{"_id": j.Id}, bson.M{"$set": set}, MediaRetryTableName)
+}
+
+// 根据媒体类型生成下载参数，消息没有绑定Bot，直接用Bot的接口下载
+func retryMediaOption(bot *openwechat.Bot, msg *openwechat.Message, j mediaRetry) (mediaOption, error) {
+	client, info := bot.Caller.Client, bot.Storage.LoginInfo
+	opt := mediaOption{kind: j.Kind, label: j.Label, sourceMd5: j.SourceMd5, defaultType: j.DefaultType}
+	switch j.Kind {
+	case mediaKindImage, mediaKindEmoticon:
+		opt.download = func() (*http.Response, error) { return client.WebWxGetMsgImg(msg, info) }
+	case mediaKindVoice:
+		opt.download = func() (*http.Response, error) { return client.WebWxGetVoice(msg, info) }
+	case mediaKindVideo:
+		opt.download = func() (*http.Response, error) { return client.WebWxGetVideo(msg, info) }
+		opt.poster = videoPoster(bot, msg)
+	case mediaKindFile:
+		opt.download = func() (*http.Response, error) { return client.WebWxGetMedia(msg, info) }
+	default:
+		return opt, fmt.Errorf("不支持的媒体类型: %v", j.Kind)
+	}
+	return opt, nil
+}
@@ -0,0 +1,95 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+	"web-wechat/core"
+	"web-wechat/oss"
+)
+
+func TestMediaReader(t *testing.T) {
+	r := &mediaReader{r: strings.NewReader("hello"), limit: 5}
+	if data, err := io.ReadAll(r); err != nil || string(data) != "hello" || r.size != 5 {
+		t.Fatalf("没超过限制不应该报错: %v, %v, %v", string(data), r.size, err)
+	}
+	r = &mediaReader{r: strings.NewReader("hello world"), limit: 5}
+	if _, err := io.ReadAll(r); !errors.Is(err, errMediaTooLarge) || !r.exceeded {
+		t.Fatalf("超过限制应该返回errMediaTooLarge，实际: %v", err)
+	}
+	r = &mediaReader{r: strings.NewReader("hello world")}
+	if _, err := io.ReadAll(r); err != nil {
+		t.Fatalf("不限制大小不应该报错: %v", err)
+	}
+}
+
+// 记录上传参数的存储
+type sizeRecordStorage struct {
+	oss.Storage
+	sizes []int64
+}
+
+func (s *sizeRecordStorage) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error {
+	s.sizes = append(s.sizes, size)
+	return s.Storage.Put(ctx, key, r, size, contentType)
+}
+
+func TestUploadMedia(t *testing.T) {
+	s := &sizeRecordStorage{Storage: oss.NewMemoryStorage()}
+	oss.SetStorage(s)
+	defer oss.SetStorage(nil)
+
+	md5sum, size, err := uploadMedia(strings.NewReader("hello"), 5, 0, "text/plain", "tmp/1/1")
+	if err != nil || md5sum != "5d41402abc4b2a76b9719d911017c592" || size != 5 {
+		t.Fatalf("上传结果错误: %v, %v, %v", md5sum, size, err)
+	}
+	// 没有Content-Length的时候传-1，由OSS分片上传
+	if _, _, err = uploadMedia(strings.NewReader("hello"), 0, 0, "text/plain", "tmp/1/2"); err != nil {
+		t.Fatal(err)
+	}
+	if len(s.sizes) != 2 || s.sizes[0] != 5 || s.sizes[1] != -1 {
+		t.Fatalf("传给OSS的大小错误: %v", s.sizes)
+	}
+	if _, _, err = uploadMedia(strings.NewReader("hello world"), -1, 5, "text/plain", "tmp/1/3"); !errors.Is(err, errMediaTooLarge) {
+		t.Fatalf("超过限制应该返回errMediaTooLarge，实际: %v", err)
+	}
+}
+
+func TestMediaBlobKey(t *testing.T) {
+	if key := mediaBlobKey("d41d8cd98f00b204e9800998ecf8427e", "image/png"); key != "blob/d4/d41d8cd98f00b204e9800998ecf8427e.png" {
+		t.Fatalf("文件名错误: %v", key)
+	}
+	if s := mediaSourceMd5(mediaKindImage, "ABC"); s != mediaKindImage+":abc" {
+		t.Fatalf("来源MD5错误: %v", s)
+	}
+	if s := mediaSourceMd5(mediaKindImage, ""); s != "" {
+		t.Fatalf("没有MD5的时候应该返回空: %v", s)
+	}
+}
+
+func TestMediaRetryBackoff(t *testing.T) {
+	if d := mediaRetryBackoff(0); d != time.Minute {
+		t.Fatalf("第一次重试间隔应该是默认的一分钟，实际: %v", d)
+	}
+	if d := mediaRetryBackoff(3); d != 8*time.Minute {
+		t.Fatalf("每次失败后间隔应该翻倍，实际: %v", d)
+	}
+	if mediaRetryBackoff(20) != mediaRetryBackoff(10) {
+		t.Fatal("重试间隔应该有上限")
+	}
+}
+
+func TestMediaProxyUrl(t *testing.T) {
+	old := core.SystemConfig.MediaConfig.ProxyUrl
+	defer func() { core.SystemConfig.MediaConfig.ProxyUrl = old }()
+	core.SystemConfig.MediaConfig.ProxyUrl = "https://wechat.example.com/"
+	if u := mediaProxyUrl("123", false); u != "https://wechat.example.com/media/123" {
+		t.Fatalf("文件链接错误: %v", u)
+	}
+	if u := mediaProxyUrl("123", true); u != "https://wechat.example.com/media/123?thumb=true" {
+		t.Fatalf("缩略图链接错误: %v", u)
+	}
+}
@@ -0,0 +1,200 @@
+package handler
+
+import (
+	"github.com/eatmoreapple/openwechat"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+	"web-wechat/event"
+	"web-wechat/oss"
+)
+
+// 当前消息表结构版本，旧数据迁移之后会写入这个版本号
+const messageSchemaVersion = 2
+
+// 保存解析后的消息结构体用的消息上下文Key
+const messageDataKey = "messageData"
+
+// MessageDocument 消息表的数据结构
+type MessageDocument struct {
+	Id            primitive.ObjectID        `bson:"_id,omitempty" json:"id"`
+	SchemaVersion int                       `bson:"schemaVersion" json:"-"`                              // 表结构版本
+	Uin           int64                     `bson:"uin" json:"uin"`                                      // 消息所属的登录用户
+	MsgId         string                    `bson:"msgId" json:"msg_id"`                                 // 消息ID
+	MsgType       openwechat.MessageType    `bson:"msgType" json:"msg_type"`                             // 消息类型
+	AppMsgType    openwechat.AppMessageType `bson:"appMsgType,omitempty" json:"app_msg_type"`            // APP消息类型
+	Direction     string                    `bson:"direction" json:"direction"`                          // 消息方向: in-收到 out-发出
+	Content       string                    `bson:"content" json:"content"`                              // 消息内容
+	MediaUrl      string                    `bson:"mediaUrl,omitempty" json:"media_url"`                 // 图片、视频等文件的链接
+	Media         *MediaRecord              `bson:"media,omitempty" json:"media,omitempty"`              // 保存的媒体文件信息
+	MediaStatus   string                    `bson:"mediaStatus,omitempty" json:"media_status,omitempty"` // 媒体文件保存状态，saved、pending(等待重试)、failed、expired(已清理)
+	Sender        *event.User               `bson:"sender" json:"sender"`                                // 发信人，群消息为群里的发信人
+	Receiver      *event.User               `bson:"receiver,omitempty" json:"receiver,omitempty"`        // 收信人，群消息为空
+	Group         *event.User               `bson:"group,omitempty" json:"group,omitempty"`              // 群组，私聊消息为空
+	Chat          *event.User               `bson:"chat" json:"chat"`                                    // 会话对象，私聊为对方，群聊为群组
+	Image         *ImageMessageData         `bson:"image,omitempty" json:"image,omitempty"`              // 图片消息内容
+	Video         *VideoMessageData         `bson:"video,omitempty" json:"video,omitempty"`              // 视频消息内容
+	Voice         *VoiceMessageData         `bson:"voice,omitempty" json:"voice,omitempty"`              // 语音消息内容
+	Emoticon      *EmoticonMessageData      `bson:"emoticon,omitempty" json:"emoticon,omitempty"`        // 表情包消息内容
+	App           *AppMessageData           `bson:"app,omitempty" json:"app,omitempty"`                  // APP消息内容
+	Location      *LocationMessageData      `bson:"location,omitempty" json:"location,omitempty"`        // 位置消息内容
+	Card          *CardMessageData          `bson:"card,omitempty" json:"card,omitempty"`                // 名片消息内容
+	RedPacket     *RedPacketMessageData     `bson:"redPacket,omitempty" json:"red_packet,omitempty"`     // 红包通知内容
+	Origin        *event.Origin             `bson:"origin,omitempty" json:"origin,omitempty"`            // 发出消息的来源
+	Delivery      *event.Delivery           `bson:"delivery,omitempty" json:"delivery,omitempty"`        // 发送结果
+	IsRead        bool                      `bson:"isRead" json:"is_read"`                               // 是否已读
+	Recalled      bool                      `bson:"recalled,omitempty" json:"recalled"`                  // 是否已被撤回
+	RecalledAt    *time.Time                `bson:"recalledAt,omitempty" json:"recalled_at,omitempty"`   // 撤回时间
+	CreateTime    time.Time                 `bson:"createTime" json:"create_time"`                       // 消息发送时间
+	SaveTime      time.Time                 `bson:"saveTime" json:"save_time"`                           // 保存时间
+}
+
+// 组装消息数据
+func newMessageDocument(ctx *openwechat.MessageContext) MessageDocument {
+	doc := MessageDocument{
+		SchemaVersion: messageSchemaVersion,
+		MsgId:         ctx.MsgId,
+		MsgType:       ctx.MsgType,
+		AppMsgType:    ctx.AppMsgType,
+		Direction:     event.DirectionIn,
+		Content:       ctx.Content,
+		CreateTime:    time.Unix(ctx.CreateTime, 0),
+		SaveTime:      time.Now(),
+	}
+	if ctx.CreateTime == 0 {
+		doc.CreateTime = doc.SaveTime
+	}
+	if self, err := ctx.Bot().GetCurrentUser(); err == nil {
+		doc.Uin = self.Uin
+	}
+	if ctx.IsSendBySelf() {
+		doc.Direction = event.DirectionOut
+		doc.Origin = &event.Origin{Source: event.SourceSync}
+	}
+	if record := getMediaRecord(ctx); record != nil {
+		doc.Media = record
+		doc.MediaUrl = record.Url
+	}
+	doc.MediaStatus = getMediaStatus(ctx)
+
+	sender, receiver, group := messageUsers(ctx)
+	doc.Sender = event.NewUser(sender)
+	doc.Receiver = event.NewUser(receiver)
+	doc.Group = event.NewUser(group)
+	doc.Chat = doc.Group
+	if doc.Chat == nil {
+		doc.Chat = doc.Sender
+		if ctx.IsSendBySelf() {
+			doc.Chat = doc.Receiver
+		}
+	}
+
+	// 各类型处理器解析出来的消息结构体
+	if data, exist := ctx.Get(messageDataKey); exist {
+		switch v := data.(type) {
+		case *ImageMessageData:
+			doc.Image = v
+		case *VideoMessageData:
+			doc.Video = v
+		case *VoiceMessageData:
+			doc.Voice = v
+		case *EmoticonMessageData:
+			doc.Emoticon = v
+		case *AppMessageData:
+			doc.App = v
+		case *LocationMessageData:
+			doc.Location = v
+		case *CardMessageData:
+			doc.Card = v
+		case *RedPacketMessageData:
+			doc.RedPacket = v
+		}
+	}
+	return doc
+}
+
+// 取出消息的发信人、收信人和群组，群消息的发信人为群里的发信人，收信人为空
+func messageUsers(ctx *openwechat.MessageContext) (sender, receiver, group *openwechat.User) {
+	sender, _ = ctx.Sender()
+	if ctx.IsComeFromGroup() {
+		if ctx.IsSendBySelf() {
+			group, _ = ctx.Receiver()
+			return
+		}
+		group = sender
+		sender, _ = ctx.SenderInGroup()
+		return
+	}
+	receiver, _ = ctx.Receiver()
+	return
+}
+
+// 用发出消息的事件组装消息数据
+func newSentMessageDocument(msg event.Message) MessageDocument {
+	doc := MessageDocument{
+		SchemaVersion: messageSchemaVersion,
+		Uin:           msg.Uin,
+		MsgId:         msg.MsgId,
+		MsgType:       openwechat.MessageType(msg.MsgType),
+		Direction:     msg.Direction,
+		Content:       msg.Content,
+		MediaUrl:      msg.MediaUrl,
+		Sender:        msg.Sender,
+		Receiver:      msg.Receiver,
+		Group:         msg.Group,
+		Chat:          msg.Group,
+		Origin:        msg.Origin,
+		Delivery:      msg.Delivery,
+		IsRead:        true,
+		CreateTime:    time.Unix(msg.CreateTime, 0),
+		SaveTime:      time.Now(),
+	}
+	if doc.Chat == nil {
+		doc.Chat = doc.Receiver
+	}
+	return doc
+}
+
+// MediaExpired 媒体文件是否已经超过保留时间被清理
+func (d *MessageDocument) MediaExpired() bool {
+	return d.MediaStatus == mediaStatusExpired
+}
+
+// RefreshMediaUrl 使用临时链接的时候，保存的链接可能已经过期，重新生成文件链接；通过接口访问文件的时候换成接口地址
+func (d *MessageDocument) RefreshMediaUrl() {
+	if d.Media == nil || d.MediaExpired() {
+		return
+	}
+	if mediaProxied() {
+		d.Media.Url = mediaProxyUrl(d.MsgId, false)
+		if d.Media.ThumbKey != "" {
+			d.Media.ThumbUrl = mediaProxyUrl(d.MsgId, true)
+		}
+		d.MediaUrl = d.Media.Url
+		return
+	}
+	if !oss.IsPresigned() {
+		return
+	}
+	d.Media.Url = oss.GetUrl(d.Media.Key)
+	d.Media.ThumbUrl = thumbUrl(d.Media.ThumbKey)
+	d.MediaUrl = d.Media.Url
+}
+
+// 转换为事件里的消息结构
+func (d MessageDocument) toEventMessage() *event.Message {
+	d.RefreshMediaUrl()
+	return &event.Message{
+		Uin:        d.Uin,
+		MsgId:      d.MsgId,
+		MsgType:    int(d.MsgType),
+		Direction:  d.Direction,
+		Content:    d.Content,
+		MediaUrl:   d.MediaUrl,
+		Sender:     d.Sender,
+		Receiver:   d.Receiver,
+		Group:      d.Group,
+		Origin:     d.Origin,
+		Delivery:   d.Delivery,
+		CreateTime: d.CreateTime.Unix(),
+	}
+}
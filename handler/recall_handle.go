@@ -0,0 +1,125 @@
+package handler
+
+import (
+	"fmt"
+	"gitee.ltd/lxh/logger/log"
+	"github.com/eatmoreapple/openwechat"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"strconv"
+	"time"
+	"web-wechat/core"
+	. "web-wechat/db"
+	"web-wechat/event"
+	"web-wechat/utils"
+)
+
+// 检查是否是撤回消息
+func checkIsRecalled(message *openwechat.Message) bool {
+	return message.IsRecalled()
+}
+
+// 撤回消息处理，原消息标记为已撤回，发布撤回事件并按配置发送撤回提醒
+func recalledMessageHandle(ctx *openwechat.MessageContext) {
+	revoke, err := ctx.RevokeMsg()
+	if err != nil {
+		log.Errorf("撤回消息解析失败: %v", err.Error())
+		log.Debugf("原始内容: %v", ctx.Content)
+		ctx.Next()
+		return
+	}
+	appKey := core.AppKeyFromContext(ctx.Bot().Context())
+	now := time.Now()
+	operator, _, group := messageUsers(ctx)
+	recall := event.Recall{
+		MsgId:      strconv.FormatInt(revoke.RevokeMsg.MsgId, 10),
+		Notice:     revoke.RevokeMsg.ReplaceMsg,
+		Operator:   event.NewUser(operator),
+		Group:      event.NewUser(group),
+		RecalledAt: now.Unix(),
+	}
+	if self, err := ctx.Bot().GetCurrentUser(); err == nil {
+		recall.Uin = self.Uin
+	}
+
+	// 查出原消息并标记为已撤回，原消息的文件已经保存在OSS，不会随撤回删除
+	filter := bson.M{"uin": recall.Uin, "msgId": recall.MsgId}
+	var list []MessageDocument
+	if err = MongoClient.Find(filter, options.Find().SetLimit(1), MessageTableName, &list); err != nil {
+		log.Errorf("查询被撤回的消息失败: %v", err.Error())
+	}
+	if len(list) > 0 {
+		recall.Original = list[0].toEventMessage()
+		MongoClient.Update(filter, bson.M{"$set": bson.M{"recalled": true, "recalledAt": now}}, MessageTableName)
+	}
+	log.Infof("[%v]消息被撤回: %v ==> 原消息ID: %v", appKey, recall.Notice, recall.MsgId)
+
+	event.Publish(appKey, event.MessageRecalled, recall)
+	// 自己撤回的消息不需要提醒
+	if !ctx.IsSendBySelf() {
+		notifyRecall(ctx, appKey, recall)
+	}
+	ctx.Next()
+}
+
+// 发送撤回提醒到配置的会话
+func notifyRecall(ctx *openwechat.MessageContext, appKey string, recall event.Recall) {
+	target := core.SystemConfig.RecallConfig.Notify
+	if target == "" {
+		return
+	}
+	self, err := ctx.Bot().GetCurrentUser()
+	if err != nil {
+		log.Errorf("获取登录用户失败: %v", err.Error())
+		return
+	}
+	receiver := findNotifyReceiver(self, target)
+	if receiver == nil {
+		log.Errorf("[%v]撤回提醒会话不存在: %v", appKey, target)
+		return
+	}
+
+	content := fmt.Sprintf("【防撤回】%v", recall.Notice)
+	if recall.Group != nil {
+		content += "\n群组：" + recall.Group.NickName
+	}
+	if recall.Original == nil {
+		content += "\n原消息未保存"
+	} else if recall.Original.MediaUrl != "" {
+		content += "\n原消息：" + recall.Original.MediaUrl
+	} else {
+		content += "\n原消息：" + recall.Original.Content
+	}
+
+	var sent *openwechat.SentMessage
+	if receiver.IsGroup() {
+		sent, err = (&openwechat.Group{User: receiver}).SendText(content)
+	} else {
+		sent, err = (&openwechat.Friend{User: receiver}).SendText(content)
+	}
+	if err != nil {
+		log.Errorf("[%v]撤回提醒发送失败: %v", appKey, err.Error())
+	}
+	origin := event.Origin{Source: event.SourceSystem, Name: "recall", TriggerMsgId: ctx.MsgId}
+	if recall.Operator != nil {
+		origin.Trigger = recall.Operator.Id
+	}
+	event.PublishSent(appKey, receiver, content, sent, err, origin)
+}
+
+// 查找撤回提醒的会话，支持文件传输助手、好友和群组
+func findNotifyReceiver(self *openwechat.Self, target string) *openwechat.User {
+	if target == openwechat.FileHelper {
+		return self.FileHelper().User
+	}
+	members, err := self.Members()
+	if err != nil {
+		log.Errorf("获取联系人失败: %v", err.Error())
+		return nil
+	}
+	result := members.Search(1, func(user *openwechat.User) bool {
+		return utils.GetUserId(user) == target || user.UserName == target ||
+			user.RemarkName == target || user.NickName == target
+	})
+	return result.First()
+}
@@ -0,0 +1,34 @@
+package handler
+
+import (
+	"gitee.ltd/lxh/logger/log"
+	"github.com/eatmoreapple/openwechat"
+)
+
+// 红包通知动作
+const (
+	redPacketReceived = "received" // 收到红包
+	redPacketSent     = "sent"     // 发出红包
+)
+
+// RedPacketMessageData 红包通知结构体，网页版看不到红包内容，只能拿到收发通知
+type RedPacketMessageData struct {
+	Action string `bson:"action" json:"action"` // received-收到红包 sent-发出红包
+	Notice string `bson:"notice" json:"notice"` // 通知内容
+}
+
+// 检查是否是红包通知
+func checkIsRedPacket(message *openwechat.Message) bool {
+	return message.IsReceiveRedPacket() || message.IsSendRedPacket()
+}
+
+// 红包通知处理
+func redPacketMessageHandle(ctx *openwechat.MessageContext) {
+	data := RedPacketMessageData{Action: redPacketReceived, Notice: ctx.Content}
+	if ctx.IsSendRedPacket() {
+		data.Action = redPacketSent
+	}
+	ctx.Set(messageDataKey, &data)
+	log.Infof("[收到红包通知] == %v", data.Notice)
+	ctx.Next()
+}
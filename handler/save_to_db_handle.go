@@ -2,55 +2,240 @@ package handler
 
 import (
 	"encoding/json"
+	"errors"
+	"gitee.ltd/lxh/logger/log"
 	"github.com/eatmoreapple/openwechat"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"strings"
 	"time"
 	. "web-wechat/db"
+	"web-wechat/event"
 )
 
+// MessageTableName 保存消息的表名
+const MessageTableName = "message"
+
+// InitMessageIndex 初始化消息表索引，历史消息按_id倒序分页查询
+func InitMessageIndex() {
+	models := []mongo.IndexModel{
+		{Keys: bson.D{{Key: "uin", Value: 1}, {Key: "_id", Value: -1}}},
+		{Keys: bson.D{{Key: "uin", Value: 1}, {Key: "chat.id", Value: 1}, {Key: "_id", Value: -1}}},
+		{Keys: bson.D{{Key: "uin", Value: 1}, {Key: "group.id", Value: 1}, {Key: "_id", Value: -1}}},
+		{Keys: bson.D{{Key: "uin", Value: 1}, {Key: "sender.id", Value: 1}, {Key: "_id", Value: -1}}},
+		{Keys: bson.D{{Key: "uin", Value: 1}, {Key: "createTime", Value: -1}}},
+		{Keys: bson.D{{Key: "schemaVersion", Value: 1}}},
+	}
+	if err := MongoClient.CreateIndexes(MessageTableName, models); err != nil {
+		log.Errorf("消息表索引初始化失败: %v", err.Error())
+	}
+}
+
+// 消息ID唯一索引的名称，和之前的普通索引区分开
+const messageUniqueIndexName = "uin_1_msgId_1_unique"
+
+// 创建消息ID唯一索引，已有的重复消息需要先去重，发送失败的消息没有消息ID，不参与唯一索引
+func ensureMessageUniqueIndex() {
+	if err := dedupeMessageDocument(); err != nil {
+		log.Errorf("消息去重失败，不创建唯一索引: %v", err.Error())
+		return
+	}
+	model := mongo.IndexModel{
+		Keys: bson.D{{Key: "uin", Value: 1}, {Key: "msgId", Value: 1}},
+		Options: options.Index().SetName(messageUniqueIndexName).SetUnique(true).
+			SetPartialFilterExpression(bson.M{"msgId": bson.M{"$gt": ""}}),
+	}
+	if err := MongoClient.CreateIndexes(MessageTableName, []mongo.IndexModel{model}); err != nil {
+		log.Errorf("消息唯一索引创建失败: %v", err.Error())
+		return
+	}
+	// 唯一索引建好之后旧的普通索引就用不到了
+	_ = MongoClient.DropIndex(MessageTableName, "uin_1_msgId_1")
+}
+
+// 删除重复保存的消息，同一个登录用户的同一条消息只保留最早保存的一条
+func dedupeMessageDocument() error {
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"msgId": bson.M{"$gt": ""}}}},
+		{{Key: "$sort", Value: bson.M{"_id": 1}}},
+		{{Key: "$group", Value: bson.M{
+			"_id":   bson.M{"uin": "$uin", "msgId": "$msgId"},
+			"ids":   bson.M{"$push": "$_id"},
+			"count": bson.M{"$sum": 1},
+		}}},
+		{{Key: "$match", Value: bson.M{"count": bson.M{"$gt": 1}}}},
+	}
+	var groups []struct {
+		Ids []primitive.ObjectID `bson:"ids"`
+	}
+	if err := MongoClient.Aggregate(pipeline, MessageTableName, &groups); err != nil {
+		return err
+	}
+	removed := 0
+	for _, group := range groups {
+		if !MongoClient.Delete(bson.M{"_id": bson.M{"$in": group.Ids[1:]}}, MessageTableName) {
+			return errors.New("删除重复消息失败")
+		}
+		removed += len(group.Ids) - 1
+	}
+	if removed > 0 {
+		log.Infof("删除了%v条重复保存的消息", removed)
+	}
+	return nil
+}
+
 // 检查是否需要保存
 func checkNeedSave(message *openwechat.Message) bool {
-	return message.IsText() || message.IsEmoticon() || message.IsPicture() || message.IsMedia()
+	return message.IsText() || message.IsEmoticon() || message.IsPicture() || message.IsVideo() || message.IsVoice() || message.IsMedia() ||
+		message.IsCard() || checkIsLocation(message) || checkIsRedPacket(message)
 }
 
 // 保存消息到MongoDB
 func saveToDb(ctx *openwechat.MessageContext) {
-	// TODO 需要解析成支持的结构体
-
-	type weChatMsg struct {
-		Uin          int64
-		MsgId        string
-		MsgType      openwechat.MessageType
-		Content      string
-		SendUserName string
-		GroupName    string
-		IsRead       int
-		BaseStr      string
-		DateTime     string
-	}
-
-	slew, _ := ctx.Bot().GetCurrentUser()
-	sender, _ := ctx.Sender()
-	senderUser := sender.NickName
-	groupName := ""
-	if ctx.IsSendByGroup() {
-		// 取出消息在群里面的发送者
-		senderInGroup, _ := ctx.SenderInGroup()
-		senderUser = senderInGroup.NickName
-		groupName = sender.NickName
-	}
-	msgStr, _ := json.Marshal(ctx)
-	msg := weChatMsg{
-		Uin:          slew.Uin,
-		MsgId:        ctx.MsgId,
-		MsgType:      ctx.MsgType,
-		Content:      ctx.Content,
-		SendUserName: senderUser,
-		GroupName:    groupName,
-		IsRead:       0,
-		BaseStr:      string(msgStr),
-		DateTime:     time.Now().In(time.FixedZone("CST", 8*3600)).Format("2006-01-02 15:04:05"),
-	}
-
-	MongoClient.Save(msg, "message")
+	doc := newMessageDocument(ctx)
+	// 本程序发出的消息可能已经保存过了，重新同步的消息也可能再收到一次，只在不存在的时候插入
+	MongoClient.Upsert(bson.M{"uin": doc.Uin, "msgId": doc.MsgId}, bson.M{"$setOnInsert": doc}, MessageTableName)
 	ctx.Next()
 }
+
+// SaveSentMessage 保存接口、WebSocket和插件发出的消息，订阅消息发出和发送失败事件
+func SaveSentMessage(e event.Event) {
+	if e.Type != event.MessageSent && e.Type != event.MessageSendFail {
+		return
+	}
+	msg, ok := e.Data.(event.Message)
+	// 同步过来的消息已经在消息处理器里面保存了
+	if !ok || msg.Origin == nil || msg.Origin.Source == event.SourceSync {
+		return
+	}
+	doc := newSentMessageDocument(msg)
+	// 发送失败的消息没有消息ID，直接保存
+	if doc.MsgId == "" {
+		MongoClient.Save(doc, MessageTableName)
+		return
+	}
+	// 同步回来的同一条消息可能先保存了，来源和发送结果以这里为准
+	doc.Origin, doc.Delivery = nil, nil
+	update := bson.M{
+		"$setOnInsert": doc,
+		"$set":         bson.M{"origin": msg.Origin, "delivery": msg.Delivery},
+	}
+	MongoClient.Upsert(bson.M{"uin": doc.Uin, "msgId": doc.MsgId}, update, MessageTableName)
+}
+
+// 旧版本的消息数据结构
+type legacyMessage struct {
+	Id           primitive.ObjectID     `bson:"_id"`
+	Uin          int64                  `bson:"uin"`
+	MsgId        string                 `bson:"msgid"`
+	MsgType      openwechat.MessageType `bson:"msgtype"`
+	Content      string                 `bson:"content"`
+	SendUserName string                 `bson:"sendusername"`
+	GroupName    string                 `bson:"groupname"`
+	IsRead       int                    `bson:"isread"`
+	BaseStr      string                 `bson:"basestr"`
+	DateTime     string                 `bson:"datetime"`
+}
+
+// 每批迁移的消息数量
+const messageMigrateBatch = 500
+
+// MigrateMessageDocument 把旧版本保存的消息转换为新的数据结构，转换完成后去重并创建消息ID唯一索引
+// 旧消息可能很多，在后台执行，每批完成后输出进度；单条转换失败的时候跳过，不影响唯一索引的创建
+func MigrateMessageDocument() {
+	defer ensureMessageUniqueIndex()
+
+	filter := bson.M{"schemaVersion": bson.M{"$exists": false}}
+	pending, err := MongoClient.Count(filter, MessageTableName)
+	if err != nil {
+		log.Errorf("统计待迁移消息失败: %v", err.Error())
+		return
+	}
+	if pending == 0 {
+		return
+	}
+	log.Infof("开始迁移旧版本消息，共%v条", pending)
+	// 按_id顺序分批处理，转换失败的消息不会被重复查出来
+	opts := options.Find().SetSort(bson.M{"_id": 1}).SetLimit(messageMigrateBatch)
+	var lastId primitive.ObjectID
+	total, failed := 0, 0
+	for {
+		batchFilter := bson.M{"schemaVersion": bson.M{"$exists": false}}
+		if !lastId.IsZero() {
+			batchFilter["_id"] = bson.M{"$gt": lastId}
+		}
+		var list []legacyMessage
+		if err = MongoClient.Find(batchFilter, opts, MessageTableName, &list); err != nil {
+			log.Errorf("查询待迁移消息失败: %v", err.Error())
+			break
+		}
+		if len(list) == 0 {
+			break
+		}
+		for _, old := range list {
+			if !MongoClient.ReplaceOne(bson.M{"_id": old.Id}, convertLegacyMessage(old), MessageTableName) {
+				log.Errorf("消息迁移失败，跳过: %v", old.Id.Hex())
+				failed++
+			}
+		}
+		lastId = list[len(list)-1].Id
+		total += len(list)
+		log.Infof("旧版本消息迁移进度: %v/%v", total, pending)
+	}
+	log.Infof("旧版本消息迁移完成，共处理%v条，失败%v条", total, failed)
+}
+
+// 转换旧版本消息
+func convertLegacyMessage(old legacyMessage) MessageDocument {
+	doc := MessageDocument{
+		Id:            old.Id,
+		SchemaVersion: messageSchemaVersion,
+		Uin:           old.Uin,
+		MsgId:         old.MsgId,
+		MsgType:       old.MsgType,
+		Direction:     event.DirectionIn,
+		Content:       old.Content,
+		Sender:        &event.User{NickName: old.SendUserName},
+		IsRead:        old.IsRead == 1,
+		SaveTime:      old.Id.Timestamp(),
+	}
+	// 旧版本的文件消息内容被替换成了文件链接
+	if old.MsgType != openwechat.MsgTypeText && strings.HasPrefix(old.Content, "http") {
+		doc.MediaUrl = old.Content
+	}
+	// 旧版本的时间是东八区的字符串
+	if t, err := time.ParseInLocation("2006-01-02 15:04:05", old.DateTime, time.FixedZone("CST", 8*3600)); err == nil {
+		doc.CreateTime = t
+		doc.SaveTime = t
+	}
+	// BaseStr保存的是完整的消息，能解析的话取出更准确的信息
+	var base openwechat.Message
+	if err := json.Unmarshal([]byte(old.BaseStr), &base); err == nil {
+		doc.AppMsgType = base.AppMsgType
+		doc.Sender.UserName = base.FromUserName
+		if base.CreateTime > 0 {
+			doc.CreateTime = time.Unix(base.CreateTime, 0)
+		}
+	}
+	if old.GroupName != "" {
+		doc.Group = &event.User{NickName: old.GroupName}
+		doc.Chat = doc.Group
+	} else {
+		doc.Chat = doc.Sender
+	}
+	return doc
+}
+
+// FindMessageDocument 查询登录用户的一条消息，不存在的时候返回nil
+func FindMessageDocument(uin int64, msgId string) (*MessageDocument, error) {
+	var list []MessageDocument
+	if err := MongoClient.Find(bson.M{"uin": uin, "msgId": msgId}, options.Find().SetLimit(1), MessageTableName, &list); err != nil {
+		return nil, err
+	}
+	if len(list) == 0 {
+		return nil, nil
+	}
+	return &list[0], nil
+}
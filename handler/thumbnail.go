@@ -0,0 +1,184 @@
+package handler
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"gitee.ltd/lxh/logger/log"
+	"github.com/eatmoreapple/openwechat"
+	"go.mongodb.org/mongo-driver/bson"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"io"
+	"net/http"
+	"web-wechat/core"
+	. "web-wechat/db"
+	"web-wechat/oss"
+)
+
+// 缩略图默认的最长边(像素)
+const defaultThumbSize = 240
+
+// 缩略图的JPEG质量
+const thumbQuality = 80
+
+// 超过这个像素数的图片不生成缩略图，避免解码的时候占用太多内存
+const thumbMaxPixels = 50 * 1000 * 1000
+
+// 缩略图的最长边
+func thumbSize() int {
+	if size := core.SystemConfig.MediaConfig.ThumbSize; size > 0 {
+		return size
+	}
+	return defaultThumbSize
+}
+
+// 缩略图的文件名
+func mediaThumbKey(md5 string) string {
+	return fmt.Sprintf("thumb/%v/%v.jpg", md5[:2], md5)
+}
+
+// 获取视频封面，网页版微信用获取图片的接口就能拿到视频的封面
+func videoPoster(bot *openwechat.Bot, msg *openwechat.Message) func() (*http.Response, error) {
+	return func() (*http.Response, error) {
+		return bot.Caller.Client.WebWxGetMsgImg(msg, bot.Storage.LoginInfo)
+	}
+}
+
+// 给图片、表情包和视频生成缩略图，图片和表情包用保存的文件生成，视频用封面生成
+func saveMediaThumb(blob *mediaBlob, opt mediaOption) {
+	var src io.ReadCloser
+	switch {
+	case opt.kind == mediaKindImage || opt.kind == mediaKindEmoticon:
+		if blob.Width*blob.Height > thumbMaxPixels {
+			log.Infof("%v尺寸%vx%v太大，不生成缩略图", opt.label, blob.Width, blob.Height)
+			return
+		}
+		obj, err := oss.GetFromOss(blob.Key)
+		if err != nil {
+			log.Errorf("%v读取失败，不生成缩略图: %v", opt.label, err.Error())
+			return
+		}
+		src = obj
+	case opt.poster != nil:
+		resp, err := opt.poster()
+		if err != nil {
+			log.Errorf("%v封面下载失败: %v", opt.label, err.Error())
+			return
+		}
+		src = resp.Body
+	default:
+		return
+	}
+	defer src.Close()
+
+	thumb, err := makeThumbnail(src, thumbSize())
+	if err != nil {
+		log.Errorf("%v缩略图生成失败: %v", opt.label, err.Error())
+		return
+	}
+	key := mediaThumbKey(blob.Md5)
+	if !oss.SaveToOss(thumb.data, int64(thumb.data.Len()), "image/jpeg", key) {
+		log.Errorf("%v缩略图保存失败", opt.label)
+		return
+	}
+	blob.ThumbKey, blob.ThumbWidth, blob.ThumbHeight = key, thumb.width, thumb.height
+	update := bson.M{"thumbKey": key, "thumbWidth": thumb.width, "thumbHeight": thumb.height}
+	// 视频保存的时候没有解析尺寸，用封面的尺寸
+	if blob.Width == 0 && blob.Height == 0 {
+		blob.Width, blob.Height = thumb.sourceWidth, thumb.sourceHeight
+		update["width"], update["height"] = thumb.sourceWidth, thumb.sourceHeight
+	}
+	MongoClient.Update(bson.M{"_id": blob.Key}, bson.M{"$set": update}, MediaBlobTableName)
+}
+
+// 生成好的缩略图
+type thumbnail struct {
+	data         *bytes.Buffer // JPEG内容
+	width        int           // 缩略图宽度
+	height       int           // 缩略图高度
+	sourceWidth  int           // 原图宽度
+	sourceHeight int           // 原图高度
+}
+
+// 生成JPEG缩略图，动图只取第一帧，透明背景填充为白色
+func makeThumbnail(r io.Reader, maxSide int) (*thumbnail, error) {
+	// 动图用image.Decode解码的时候只会返回第一帧
+	src, _, err := image.Decode(r)
+	if err != nil {
+		return nil, err
+	}
+	bounds := src.Bounds()
+	if bounds.Dx() <= 0 || bounds.Dy() <= 0 {
+		return nil, errors.New("图片尺寸错误")
+	}
+	width, height := thumbDimensions(bounds.Dx(), bounds.Dy(), maxSide)
+
+	// 先画到白色背景上，JPEG不支持透明
+	canvas := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(canvas, canvas.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	draw.Draw(canvas, canvas.Bounds(), src, bounds.Min, draw.Over)
+
+	thumb := &thumbnail{data: new(bytes.Buffer), width: width, height: height, sourceWidth: bounds.Dx(), sourceHeight: bounds.Dy()}
+	if err = jpeg.Encode(thumb.data, resizeImage(canvas, width, height), &jpeg.Options{Quality: thumbQuality}); err != nil {
+		return nil, err
+	}
+	return thumb, nil
+}
+
+// 按最长边等比例计算缩略图尺寸，比最长边小的图片不放大
+func thumbDimensions(width, height, maxSide int) (int, int) {
+	if width <= maxSide && height <= maxSide {
+		return width, height
+	}
+	if width >= height {
+		h := height * maxSide / width
+		if h < 1 {
+			h = 1
+		}
+		return maxSide, h
+	}
+	w := width * maxSide / height
+	if w < 1 {
+		w = 1
+	}
+	return w, maxSide
+}
+
+// 区域平均缩小图片，每个目标像素取对应区域所有像素的平均值
+func resizeImage(src *image.RGBA, width, height int) *image.RGBA {
+	sw, sh := src.Bounds().Dx(), src.Bounds().Dy()
+	if sw == width && sh == height {
+		return src
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		y0, y1 := y*sh/height, (y+1)*sh/height
+		if y1 <= y0 {
+			y1 = y0 + 1
+		}
+		for x := 0; x < width; x++ {
+			x0, x1 := x*sw/width, (x+1)*sw/width
+			if x1 <= x0 {
+				x1 = x0 + 1
+			}
+			var r, g, b, a, n uint32
+			for sy := y0; sy < y1; sy++ {
+				i := src.PixOffset(x0, sy)
+				for sx := x0; sx < x1; sx++ {
+					r += uint32(src.Pix[i])
+					g += uint32(src.Pix[i+1])
+					b += uint32(src.Pix[i+2])
+					a += uint32(src.Pix[i+3])
+					i += 4
+					n++
+				}
+			}
+			j := dst.PixOffset(x, y)
+			dst.Pix[j], dst.Pix[j+1], dst.Pix[j+2], dst.Pix[j+3] = uint8(r/n), uint8(g/n), uint8(b/n), uint8(a/n)
+		}
+	}
+	return dst
+}
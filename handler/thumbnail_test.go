@@ -0,0 +1,57 @@
+package handler
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"testing"
+)
+
+func TestThumbDimensions(t *testing.T) {
+	cases := []struct{ w, h, ew, eh int }{
+		{100, 50, 100, 50},
+		{1000, 500, 240, 120},
+		{500, 1000, 120, 240},
+		{10000, 10, 240, 1},
+	}
+	for _, c := range cases {
+		if w, h := thumbDimensions(c.w, c.h, 240); w != c.ew || h != c.eh {
+			t.Errorf("%vx%v 应该缩放为 %vx%v，实际 %vx%v", c.w, c.h, c.ew, c.eh, w, h)
+		}
+	}
+}
+
+func TestMakeThumbnailGif(t *testing.T) {
+	palette := color.Palette{color.Black, color.White}
+	anim := &gif.GIF{}
+	for _, c := range []uint8{0, 1} {
+		frame := image.NewPaletted(image.Rect(0, 0, 480, 240), palette)
+		for i := range frame.Pix {
+			frame.Pix[i] = c
+		}
+		anim.Image = append(anim.Image, frame)
+		anim.Delay = append(anim.Delay, 10)
+	}
+	var buf bytes.Buffer
+	if err := gif.EncodeAll(&buf, anim); err != nil {
+		t.Fatal(err)
+	}
+
+	thumb, err := makeThumbnail(&buf, 240)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if thumb.width != 240 || thumb.height != 120 || thumb.sourceWidth != 480 || thumb.sourceHeight != 240 {
+		t.Fatalf("缩略图尺寸错误: %+v", thumb)
+	}
+	img, err := jpeg.Decode(thumb.data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 只取第一帧，第一帧是黑色
+	if r, _, _, _ := img.At(120, 60).RGBA(); r>>8 > 16 {
+		t.Fatalf("应该使用动图的第一帧，实际颜色: %v", r>>8)
+	}
+}
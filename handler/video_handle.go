@@ -1,21 +1,15 @@
 package handler
 
 import (
-	"bytes"
 	"encoding/xml"
 	"fmt"
 	"gitee.ltd/lxh/logger/log"
 	"github.com/eatmoreapple/openwechat"
-	"io"
-	"net/http"
-	"strings"
-	"web-wechat/core"
-	"web-wechat/oss"
 )
 
 // VideoMessageData 图片消息结构体
 type VideoMessageData struct {
-	XMlName  xml.Name `xml:"msg"`
+	XMlName  xml.Name `xml:"msg" bson:"-" json:"-"`
 	VideoMsg struct {
 		AesKey            string `xml:"aeskey,attr"`
 		CdnVideoUrl       string `xml:"cdnvideourl,attr"`
@@ -54,37 +48,8 @@ func videoMessageHandle(ctx *openwechat.MessageContext) {
 		log.Debugf("发信人: %v ==> 原始内容: %v", senderUser, ctx.Content)
 		return
 	}
+	ctx.Set(messageDataKey, &data)
 	log.Infof("[收到新视频消息] == 发信人：%v", senderUser)
-	fileResp, err := ctx.GetVideo()
-	if err != nil {
-		log.Errorf("视频下载失败: %v", err.Error())
-		return
-	}
-	defer fileResp.Body.Close()
-	videoFileByte, err := io.ReadAll(fileResp.Body)
-	if err != nil {
-		log.Errorf("视频读取错误: %v", err.Error())
-		return
-	} else {
-		// 读取文件相关信息
-		contentType := http.DetectContentType(videoFileByte)
-		fileType := strings.Split(contentType, "/")[1]
-		fileName := fmt.Sprintf("%v.%v", ctx.MsgId, fileType)
-		if user, err := ctx.Bot().GetCurrentUser(); err == nil {
-			uin := user.Uin
-			fileName = fmt.Sprintf("%v/%v", uin, fileName)
-		}
-
-		// 上传文件
-		reader2 := io.NopCloser(bytes.NewReader(videoFileByte))
-		flag := oss.SaveToOss(reader2, contentType, fileName)
-		if flag {
-			fileUrl := fmt.Sprintf("https://%v/%v/%v", core.SystemConfig.OssConfig.Endpoint, core.SystemConfig.OssConfig.BucketName, fileName)
-			log.Infof("视频保存成功，视频链接: %v", fileUrl)
-			ctx.Content = fileUrl
-		} else {
-			log.Error("视频保存失败")
-		}
-	}
+	saveMessageMedia(ctx, mediaOption{kind: mediaKindVideo, label: "视频", download: ctx.GetVideo, sourceMd5: data.VideoMsg.Md5, poster: videoPoster(ctx.Bot(), ctx.Message)})
 	ctx.Next()
 }
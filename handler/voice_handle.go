@@ -0,0 +1,66 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"gitee.ltd/lxh/logger/log"
+	"github.com/eatmoreapple/openwechat"
+	"time"
+	"web-wechat/core"
+	"web-wechat/speech"
+)
+
+// VoiceMessageData 语音消息结构体
+type VoiceMessageData struct {
+	Length          int    `bson:"length" json:"length"`                                        // 语音时长(毫秒)
+	Transcript      string `bson:"transcript,omitempty" json:"transcript,omitempty"`            // 语音识别结果
+	TranscriptError string `bson:"transcriptError,omitempty" json:"transcript_error,omitempty"` // 语音识别失败原因
+}
+
+func voiceMessageHandle(ctx *openwechat.MessageContext) {
+	sender, _ := ctx.Sender()
+	senderUser := sender.NickName
+	if ctx.IsSendByGroup() {
+		// 取出消息在群里面的发送者
+		senderInGroup, _ := ctx.SenderInGroup()
+		senderUser = fmt.Sprintf("%v[%v]", senderInGroup.NickName, senderUser)
+	}
+	data := VoiceMessageData{Length: ctx.VoiceLength}
+	ctx.Set(messageDataKey, &data)
+	log.Infof("[收到新语音消息] == 发信人：%v ==> 时长：%vms", senderUser, data.Length)
+
+	// 网页版的语音是mp3格式，没有ID3头的时候识别不出来类型
+	opt := mediaOption{kind: mediaKindVoice, label: "语音", download: ctx.GetVoice, defaultType: "audio/mpeg"}
+	// 语音大小受media.maxSize.voice限制，需要识别的时候上传的同时留一份在内存里
+	var audio bytes.Buffer
+	if speech.Enabled() {
+		opt.capture = &audio
+	}
+	record := saveMessageMedia(ctx, opt)
+
+	// 语音识别，结果和消息一起保存
+	if record != nil && speech.Enabled() {
+		transcribeVoice(&data, audio.Bytes(), record.ContentType)
+	}
+	ctx.Next()
+}
+
+// 识别语音内容，失败原因记录到消息里
+func transcribeVoice(data *VoiceMessageData, audio []byte, contentType string) {
+	timeout := core.SystemConfig.SpeechConfig.Timeout
+	if timeout <= 0 {
+		timeout = 30
+	}
+	c, cancel := context.WithTimeout(context.Background(), time.Duration(timeout)*time.Second)
+	defer cancel()
+
+	text, err := speech.Transcribe(c, audio, contentType)
+	if err != nil {
+		log.Errorf("语音识别失败: %v", err.Error())
+		data.TranscriptError = err.Error()
+		return
+	}
+	log.Infof("语音识别结果: %v", text)
+	data.Transcript = text
+}
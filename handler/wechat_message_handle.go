@@ -13,14 +13,19 @@ func HandleMessage(bot *openwechat.Bot) {
 	// 处理消息为已读
 	dispatcher.RegisterHandler(checkIsCanRead, setTheMessageAsRead)
 
-	// 默认启用插件
-	plugins.ChangePluginStatus(true)
-	// 注册插件
-	//dispatcher.OnText(plugins.WeChatPluginInstance.Status) // 优先处理插件状态相关指令
-	dispatcher.RegisterHandler(plugins.WeChatPluginInstance.CheckIsOpen,
-		plugins.WeChatPluginInstance.OpenGPT,
-		plugins.WeChatPluginInstance.Command,
-		plugins.WeChatPluginInstance.Status)
+	// 群系统通知解析为群事件，需要在插件之前处理，插件才能取到群事件
+	dispatcher.RegisterHandler(checkIsGroupNotice, groupNoticeHandle)
+
+	// 注册插件，插件默认开启，每个会话可以单独开关；插件开关指令和帮助放在最前面，新插件加在后面
+	plugins.Register(
+		plugins.StatusPlugin{},
+		plugins.HelpPlugin{},
+		plugins.AdminPlugin{},
+		&plugins.OpenGptPlugin{},
+		plugins.HolidayPlugin{},
+		plugins.OffWorkPlugin{},
+	)
+	dispatcher.RegisterHandler(plugins.CheckIsPluginMessage, plugins.HandleMessage)
 
 	// 注册文本消息处理函数
 	dispatcher.OnText(textMessageHandle)
@@ -30,10 +35,22 @@ func HandleMessage(bot *openwechat.Bot) {
 	dispatcher.OnEmoticon(emoticonMessageHandle)
 	// 注册视频消息处理器
 	dispatcher.OnVideo(videoMessageHandle)
+	// 注册语音消息处理器
+	dispatcher.OnVoice(voiceMessageHandle)
+	// 注册位置消息处理器
+	dispatcher.RegisterHandler(checkIsLocation, locationMessageHandle)
+	// 注册名片消息处理器
+	dispatcher.OnCard(cardMessageHandle)
+	// 注册红包通知处理器
+	dispatcher.RegisterHandler(checkIsRedPacket, redPacketMessageHandle)
 	// APP消息处理
 	dispatcher.OnMedia(appMessageHandle)
+	// 撤回消息处理
+	dispatcher.RegisterHandler(checkIsRecalled, recalledMessageHandle)
 	// 保存消息
 	dispatcher.RegisterHandler(checkNeedSave, saveToDb)
+	// 发布消息事件
+	dispatcher.RegisterHandler(checkNeedPublish, publishMessage)
 	// 未定义消息处理
 	dispatcher.RegisterHandler(checkIsOther, otherMessageHandle)
 
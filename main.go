@@ -6,12 +6,20 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/spf13/viper"
 	"os"
+	"os/signal"
+	"syscall"
 	"web-wechat/core"
 	"web-wechat/db"
+	"web-wechat/event"
 	"web-wechat/global"
+	"web-wechat/handler"
 	"web-wechat/middleware"
 	"web-wechat/oss"
+	"web-wechat/plugins"
 	"web-wechat/route"
+	"web-wechat/speech"
+	"web-wechat/stream"
+	"web-wechat/webhook"
 )
 
 func init() {
@@ -41,10 +49,24 @@ func init() {
 
 	// 初始化OSS
 	oss.InitOssConnHandle()
+	// 初始化语音识别
+	speech.InitTranscriber()
 	// 初始化MongoDB
 	db.InitMongoConnHandle()
+	// 初始化消息表索引并迁移旧版本消息
+	handler.InitMessageIndex()
+	// 旧消息多的时候迁移比较慢，放到后台执行，不影响启动
+	go handler.MigrateMessageDocument()
+	handler.InitGroupEventIndex()
+	handler.InitMediaIndex()
+	handler.InitMediaRetryIndex()
 	// 初始化Redis连接
 	db.InitRedisConnHandle()
+
+	// 注册事件订阅，收发的消息推送到Webhook和WebSocket
+	event.Subscribe(webhook.EventHandle)
+	event.Subscribe(stream.EventHandle)
+	event.Subscribe(handler.SaveSentMessage)
 }
 
 // 程序启动入口
@@ -65,6 +87,20 @@ func main() {
 	// 初始化Redis里登录的数据
 	global.InitBotWithStart()
 
+	// 启动媒体文件下载重试任务
+	handler.StartMediaRetry(global.GetBot)
+	// 启动过期媒体文件清理任务
+	handler.StartMediaJanitor()
+
+	// 程序退出的时候关闭插件
+	go func() {
+		quit := make(chan os.Signal, 1)
+		signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+		<-quit
+		plugins.Shutdown()
+		os.Exit(0)
+	}()
+
 	// 监听端口
 	_ = app.Run(":8888")
 }
@@ -5,6 +5,7 @@ import (
 	"strings"
 	"web-wechat/core"
 	"web-wechat/global"
+	"web-wechat/stream"
 )
 
 // CheckAppKeyIsLoggedInMiddleware 检查AppKey是否已登录微信
@@ -32,6 +33,11 @@ func CheckAppKeyIsLoggedInMiddleware() gin.HandlerFunc {
 func CheckAppKeyExistMiddleware() gin.HandlerFunc {
 	return func(ctx *gin.Context) {
 		appKey := ctx.Request.Header.Get("AppKey")
+		// 浏览器建立WebSocket连接的时候没法自定义请求头，通过子协议传入，不放在链接参数里避免写进访问日志
+		if len(appKey) < 1 && ctx.IsWebsocket() {
+			appKey = stream.ProtocolAppKey(ctx.Request)
+			ctx.Request.Header.Set("AppKey", appKey)
+		}
 		// 先判断AppKey是不是传了
 		if len(appKey) < 1 {
 			core.FailWithMessage("AppKey为必传参数", ctx)
@@ -0,0 +1,100 @@
+package oss
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"sync"
+	"time"
+)
+
+// 内存存储，重启后文件丢失，用于测试
+type memoryStorage struct {
+	mu      sync.RWMutex
+	objects map[string]memoryObject
+}
+
+type memoryObject struct {
+	data []byte
+	info ObjectInfo
+}
+
+// NewMemoryStorage 创建内存存储
+func NewMemoryStorage() Storage {
+	return &memoryStorage{objects: map[string]memoryObject{}}
+}
+
+func (m *memoryStorage) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.objects[key] = memoryObject{
+		data: data,
+		info: ObjectInfo{Key: key, Size: int64(len(data)), ContentType: contentType, LastModified: time.Now()},
+	}
+	return nil
+}
+
+func (m *memoryStorage) Get(ctx context.Context, key string) (io.ReadSeekCloser, ObjectInfo, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	obj, ok := m.objects[key]
+	if !ok {
+		return nil, ObjectInfo{}, ErrNotFound
+	}
+	return nopSeekCloser{bytes.NewReader(obj.data)}, obj.info, nil
+}
+
+func (m *memoryStorage) Stat(ctx context.Context, key string) (ObjectInfo, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	obj, ok := m.objects[key]
+	if !ok {
+		return ObjectInfo{}, ErrNotFound
+	}
+	return obj.info, nil
+}
+
+func (m *memoryStorage) Delete(ctx context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.objects, key)
+	return nil
+}
+
+func (m *memoryStorage) Copy(ctx context.Context, src, dst string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	obj, ok := m.objects[src]
+	if !ok {
+		return ErrNotFound
+	}
+	obj.info.Key = dst
+	m.objects[dst] = obj
+	return nil
+}
+
+func (m *memoryStorage) Move(ctx context.Context, src, dst string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	obj, ok := m.objects[src]
+	if !ok {
+		return ErrNotFound
+	}
+	delete(m.objects, src)
+	obj.info.Key = dst
+	m.objects[dst] = obj
+	return nil
+}
+
+// 给bytes.Reader加上Close方法
+type nopSeekCloser struct {
+	*bytes.Reader
+}
+
+func (nopSeekCloser) Close() error {
+	return nil
+}
@@ -2,56 +2,132 @@ package oss
 
 import (
 	"context"
-	"gitee.ltd/lxh/logger/log"
+	"fmt"
 	"github.com/minio/minio-go/v7"
 	"github.com/minio/minio-go/v7/pkg/credentials"
 	"io"
-	"web-wechat/core"
+	"time"
 )
 
-var minioClient *minio.Client
+// MinIO或者其他S3兼容的存储
+type minioStorage struct {
+	client *minio.Client
+	bucket string
+}
 
-// InitOssConnHandle 初始化OSS连接
-func InitOssConnHandle() {
-	ctx := context.Background()
-	// 初使化 minio client对象。
-	client, err := minio.New(core.SystemConfig.OssConfig.Endpoint, &minio.Options{
-		Creds:  credentials.NewStaticV4(core.SystemConfig.OssConfig.AccessKeyID, core.SystemConfig.OssConfig.SecretAccessKey, ""),
-		Secure: core.SystemConfig.OssConfig.UseSsl,
+// 配置里的桶访问方式
+var bucketLookups = map[string]minio.BucketLookupType{
+	"":     minio.BucketLookupAuto,
+	"auto": minio.BucketLookupAuto,
+	"path": minio.BucketLookupPath,
+	"dns":  minio.BucketLookupDNS,
+}
+
+// NewMinioStorage 创建MinIO存储，桶不存在的时候自动创建
+// bucketLookup为客户端访问桶的方式: auto(默认)、path、dns，和文件链接的格式无关
+func NewMinioStorage(endpoint, accessKeyID, secretAccessKey, bucket string, useSsl bool, bucketLookup string) (Storage, error) {
+	lookup, ok := bucketLookups[bucketLookup]
+	if !ok {
+		return nil, fmt.Errorf("不支持的桶访问方式: %v", bucketLookup)
+	}
+	client, err := minio.New(endpoint, &minio.Options{
+		Creds:        credentials.NewStaticV4(accessKeyID, secretAccessKey, ""),
+		Secure:       useSsl,
+		BucketLookup: lookup,
 	})
 	if err != nil {
-		log.Panicf("OSS初始化失败: %v", err.Error())
+		return nil, err
 	}
-	log.Info("OSS连接成功，开始判断桶是否存在")
+	ctx := context.Background()
 	// 判断捅是否存在，不存在就创建
-	exists, err := client.BucketExists(ctx, core.SystemConfig.OssConfig.BucketName)
+	exists, err := client.BucketExists(ctx, bucket)
 	if err != nil {
-		log.Panicf("判断桶失败: %v", err)
+		return nil, err
 	}
 	if !exists {
-		log.Info("桶不存在，开始创建")
-		// 创建桶
-		err = client.MakeBucket(ctx, core.SystemConfig.OssConfig.BucketName, minio.MakeBucketOptions{Region: "us-east-1"})
-		if err != nil {
-			log.Panicf("OSS桶创建失败: %v", err.Error())
+		if err = client.MakeBucket(ctx, bucket, minio.MakeBucketOptions{Region: "us-east-1"}); err != nil {
+			return nil, err
 		}
-		log.Info("桶创建成功")
-	} else {
-		log.Info("桶已存在")
 	}
-	minioClient = client
-	log.Info("OSS初始化成功")
+	return &minioStorage{client: client, bucket: bucket}, nil
 }
 
-// SaveToOss 保存文件到OSS
-func SaveToOss(b io.Reader, contentType, fileName string) bool {
-	log.Debugf("开始上传文件: %v", fileName)
-	ctx := context.Background()
-	_, err := minioClient.PutObject(ctx, core.SystemConfig.OssConfig.BucketName, fileName, b, -1, minio.PutObjectOptions{ContentType: contentType})
+func (m *minioStorage) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error {
+	_, err := m.client.PutObject(ctx, m.bucket, key, r, size, minioPutOptions(size, contentType))
+	return err
+}
+
+// 大小未知时分片上传的分片大小，不指定的时候MinIO按最大文件计算分片，每次上传都会申请500多MB的缓冲区
+const minioPartSize = 16 << 20
+
+// 上传参数，大小未知的时候指定分片大小
+func minioPutOptions(size int64, contentType string) minio.PutObjectOptions {
+	opts := minio.PutObjectOptions{ContentType: contentType}
+	if size < 0 {
+		opts.PartSize = minioPartSize
+	}
+	return opts
+}
+
+func (m *minioStorage) Get(ctx context.Context, key string) (io.ReadSeekCloser, ObjectInfo, error) {
+	obj, err := m.client.GetObject(ctx, m.bucket, key, minio.GetObjectOptions{})
 	if err != nil {
-		log.Errorf("文件上传错误: %v", err)
-		return false
+		return nil, ObjectInfo{}, minioError(err)
 	}
-	log.Debugf("文件上传完毕: %v", fileName)
-	return true
+	// GetObject不会立即请求服务端，Stat一下确认文件确实存在
+	stat, err := obj.Stat()
+	if err != nil {
+		_ = obj.Close()
+		return nil, ObjectInfo{}, minioError(err)
+	}
+	return obj, minioObjectInfo(stat), nil
+}
+
+func (m *minioStorage) Stat(ctx context.Context, key string) (ObjectInfo, error) {
+	stat, err := m.client.StatObject(ctx, m.bucket, key, minio.StatObjectOptions{})
+	if err != nil {
+		return ObjectInfo{}, minioError(err)
+	}
+	return minioObjectInfo(stat), nil
+}
+
+func (m *minioStorage) Delete(ctx context.Context, key string) error {
+	return m.client.RemoveObject(ctx, m.bucket, key, minio.RemoveObjectOptions{})
+}
+
+// Copy 在服务端复制，不经过本程序，超过5GB的文件自动分片复制
+func (m *minioStorage) Copy(ctx context.Context, src, dst string) error {
+	_, err := m.client.ComposeObject(ctx,
+		minio.CopyDestOptions{Bucket: m.bucket, Object: dst},
+		minio.CopySrcOptions{Bucket: m.bucket, Object: src},
+	)
+	return minioError(err)
+}
+
+// Move S3没有改名操作，复制之后删除源文件
+func (m *minioStorage) Move(ctx context.Context, src, dst string) error {
+	if err := m.Copy(ctx, src, dst); err != nil {
+		return err
+	}
+	return m.Delete(ctx, src)
+}
+
+func (m *minioStorage) PresignedUrl(ctx context.Context, key string, expire time.Duration) (string, error) {
+	u, err := m.client.PresignedGetObject(ctx, m.bucket, key, expire, nil)
+	if err != nil {
+		return "", err
+	}
+	return u.String(), nil
+}
+
+// 文件不存在的错误转换为ErrNotFound
+func minioError(err error) error {
+	if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+		return ErrNotFound
+	}
+	return err
+}
+
+func minioObjectInfo(stat minio.ObjectInfo) ObjectInfo {
+	return ObjectInfo{Key: stat.Key, Size: stat.Size, ContentType: stat.ContentType, LastModified: stat.LastModified}
 }
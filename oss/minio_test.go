@@ -6,3 +6,12 @@ func TestUpload(t *testing.T) {
 	InitOssConnHandle()
 
 }
+
+func TestMinioPutOptions(t *testing.T) {
+	if opts := minioPutOptions(-1, "image/png"); opts.PartSize != minioPartSize || opts.ContentType != "image/png" {
+		t.Fatalf("大小未知时应该指定分片大小: %+v", opts)
+	}
+	if opts := minioPutOptions(1024, "image/png"); opts.PartSize != 0 {
+		t.Fatalf("大小已知时不需要指定分片大小: %+v", opts)
+	}
+}
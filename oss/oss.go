@@ -0,0 +1,94 @@
+package oss
+
+import (
+	"context"
+	"gitee.ltd/lxh/logger/log"
+	"io"
+	"web-wechat/core"
+)
+
+// 当前使用的文件存储
+var storage Storage
+
+// InitOssConnHandle 根据配置初始化文件存储，初始化失败不影响启动，文件保存会失败
+func InitOssConnHandle() {
+	conf := core.SystemConfig.OssConfig
+	var err error
+	switch conf.Driver {
+	case "local":
+		storage, err = NewLocalStorage(conf.LocalPath)
+	case "memory":
+		log.Info("使用内存存储文件，重启后文件会丢失")
+		storage = NewMemoryStorage()
+	default:
+		storage, err = NewMinioStorage(conf.Endpoint, conf.AccessKeyID, conf.SecretAccessKey, conf.BucketName, conf.UseSsl, conf.BucketLookup)
+	}
+	if err != nil {
+		log.Errorf("OSS初始化失败，文件将无法保存: %v", err.Error())
+		storage = nil
+		return
+	}
+	log.Info("OSS初始化成功")
+}
+
+// SetStorage 设置文件存储，测试的时候可以换成内存存储
+func SetStorage(s Storage) {
+	storage = s
+}
+
+// GetStorage 获取当前的文件存储，没有初始化成功的时候返回nil
+func GetStorage() Storage {
+	return storage
+}
+
+// SaveToOss 保存文件到OSS，size为文件大小，未知时传-1
+func SaveToOss(b io.Reader, size int64, contentType, fileName string) bool {
+	if storage == nil {
+		log.Errorf("OSS未初始化，文件保存失败: %v", fileName)
+		return false
+	}
+	log.Debugf("开始上传文件: %v", fileName)
+	if err := storage.Put(context.Background(), fileName, b, size, contentType); err != nil {
+		log.Errorf("文件上传错误: %v", err)
+		return false
+	}
+	log.Debugf("文件上传完毕: %v", fileName)
+	return true
+}
+
+// DeleteFromOss 删除OSS里的文件
+func DeleteFromOss(fileName string) error {
+	if storage == nil {
+		return ErrNotInit
+	}
+	return storage.Delete(context.Background(), fileName)
+}
+
+// MoveInOss 移动OSS里的文件，在存储内部完成，不经过本程序
+func MoveInOss(src, dst string) error {
+	if storage == nil {
+		return ErrNotInit
+	}
+	return storage.Move(context.Background(), src, dst)
+}
+
+// OpenFromOss 打开OSS里的文件，返回的文件支持Seek，可以用来响应分段请求
+func OpenFromOss(fileName string) (io.ReadSeekCloser, ObjectInfo, error) {
+	if storage == nil {
+		return nil, ObjectInfo{}, ErrNotInit
+	}
+	return storage.Get(context.Background(), fileName)
+}
+
+// GetFromOss 从OSS读取文件
+func GetFromOss(fileName string) (io.ReadCloser, error) {
+	if storage == nil {
+		return nil, ErrNotInit
+	}
+	obj, _, err := storage.Get(context.Background(), fileName)
+	if err != nil {
+		log.Errorf("文件读取错误: %v", err)
+		return nil, err
+	}
+	return obj, nil
+}
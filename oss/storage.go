@@ -0,0 +1,45 @@
+package oss
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+)
+
+var (
+	// ErrNotFound 文件不存在
+	ErrNotFound = errors.New("文件不存在")
+	// ErrNotInit 文件存储没有初始化
+	ErrNotInit = errors.New("OSS未初始化")
+)
+
+// ObjectInfo 文件信息
+type ObjectInfo struct {
+	Key          string    // 文件名
+	Size         int64     // 文件大小(字节)
+	ContentType  string    // 文件类型
+	LastModified time.Time // 最后修改时间
+}
+
+// Presigner 支持生成临时访问链接的存储
+type Presigner interface {
+	// PresignedUrl 生成文件的临时访问链接
+	PresignedUrl(ctx context.Context, key string, expire time.Duration) (string, error)
+}
+
+// Storage 文件存储接口，文件名使用/分隔目录
+type Storage interface {
+	// Put 保存文件，size未知时传-1
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	// Get 读取文件，文件不存在时返回ErrNotFound
+	Get(ctx context.Context, key string) (io.ReadSeekCloser, ObjectInfo, error)
+	// Stat 获取文件信息，文件不存在时返回ErrNotFound
+	Stat(ctx context.Context, key string) (ObjectInfo, error)
+	// Delete 删除文件，文件不存在时不返回错误
+	Delete(ctx context.Context, key string) error
+	// Copy 复制文件，源文件不存在时返回ErrNotFound
+	Copy(ctx context.Context, src, dst string) error
+	// Move 移动文件，源文件不存在时返回ErrNotFound
+	Move(ctx context.Context, src, dst string) error
+}
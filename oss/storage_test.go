@@ -0,0 +1,96 @@
+package oss
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestMemoryStorage(t *testing.T) {
+	testStorage(t, NewMemoryStorage())
+}
+
+func TestLocalStorage(t *testing.T) {
+	s, err := NewLocalStorage(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	testStorage(t, s)
+	// 不能跳出根目录
+	if err = s.Put(context.Background(), "../../escape.txt", strings.NewReader("x"), -1, "text/plain"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = s.Stat(context.Background(), "escape.txt"); err != nil {
+		t.Fatalf("跳出根目录的文件名应该保存在根目录下: %v", err)
+	}
+}
+
+func testStorage(t *testing.T, s Storage) {
+	ctx := context.Background()
+	key := "123/456.txt"
+	if _, err := s.Stat(ctx, key); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("文件不存在时应该返回ErrNotFound，实际: %v", err)
+	}
+	if err := s.Put(ctx, key, strings.NewReader("hello"), -1, "text/plain; charset=utf-8"); err != nil {
+		t.Fatal(err)
+	}
+	obj, info, err := s.Get(ctx, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size != 5 || !strings.HasPrefix(info.ContentType, "text/plain") {
+		t.Fatalf("文件信息错误: %+v", info)
+	}
+	// 支持Seek，断点续传要用
+	if _, err = obj.Seek(1, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := io.ReadAll(obj)
+	_ = obj.Close()
+	if string(data) != "ello" {
+		t.Fatalf("文件内容错误: %v", string(data))
+	}
+	if err = s.Delete(ctx, key); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err = s.Get(ctx, key); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("删除后应该返回ErrNotFound，实际: %v", err)
+	}
+	// 重复删除不报错
+	if err = s.Delete(ctx, key); err != nil {
+		t.Fatal(err)
+	}
+
+	// 复制和移动
+	if err = s.Put(ctx, "tmp/1", strings.NewReader("hello"), 5, "text/plain; charset=utf-8"); err != nil {
+		t.Fatal(err)
+	}
+	if err = s.Copy(ctx, "tmp/1", "copy/1.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if err = s.Move(ctx, "tmp/1", "blob/1.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = s.Stat(ctx, "tmp/1"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("移动后源文件应该不存在，实际: %v", err)
+	}
+	for _, dst := range []string{"copy/1.txt", "blob/1.txt"} {
+		obj, info, err = s.Get(ctx, dst)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ = io.ReadAll(obj)
+		_ = obj.Close()
+		if string(data) != "hello" || info.Key != dst || !strings.HasPrefix(info.ContentType, "text/plain") {
+			t.Fatalf("%v文件错误: %v, %+v", dst, string(data), info)
+		}
+	}
+	if err = s.Move(ctx, "tmp/1", "blob/2.txt"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("源文件不存在时应该返回ErrNotFound，实际: %v", err)
+	}
+	if err = s.Copy(ctx, "tmp/1", "blob/2.txt"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("源文件不存在时应该返回ErrNotFound，实际: %v", err)
+	}
+}
@@ -0,0 +1,76 @@
+package oss
+
+import (
+	"context"
+	"fmt"
+	"gitee.ltd/lxh/logger/log"
+	"net/url"
+	"strings"
+	"time"
+	"web-wechat/core"
+)
+
+// MinIO链接格式
+const (
+	UrlStylePath    = "path"    // endpoint/bucket/文件名
+	UrlStyleVirtual = "virtual" // bucket.endpoint/文件名
+)
+
+// 临时链接有效期，S3最长支持7天
+const (
+	defaultPresignExpire = time.Hour
+	maxPresignExpire     = 7 * 24 * time.Hour
+)
+
+// IsPresigned 文件链接是否是有有效期的临时链接，临时链接不能长期保存，使用的时候需要重新生成
+func IsPresigned() bool {
+	conf := core.SystemConfig.OssConfig
+	_, ok := storage.(Presigner)
+	return conf.PublicUrl == "" && conf.Presign && ok
+}
+
+// GetUrl 获取文件的访问链接
+// 配置了publicUrl时使用publicUrl拼接，开启了presign时生成临时链接，否则按urlStyle拼接MinIO地址
+func GetUrl(key string) string {
+	conf := core.SystemConfig.OssConfig
+	path := escapeKey(key)
+	if conf.PublicUrl != "" {
+		return strings.TrimRight(conf.PublicUrl, "/") + "/" + path
+	}
+	if IsPresigned() {
+		expire := time.Duration(conf.PresignExpire) * time.Second
+		if expire <= 0 {
+			expire = defaultPresignExpire
+		}
+		if expire > maxPresignExpire {
+			expire = maxPresignExpire
+		}
+		u, err := storage.(Presigner).PresignedUrl(context.Background(), key, expire)
+		if err != nil {
+			log.Errorf("生成临时链接失败: %v", err.Error())
+			return ""
+		}
+		return u
+	}
+	if _, ok := storage.(*minioStorage); !ok {
+		// 本地存储和内存存储没有公开地址，需要配置publicUrl
+		return ""
+	}
+	scheme := "http"
+	if conf.UseSsl {
+		scheme = "https"
+	}
+	if conf.UrlStyle == UrlStyleVirtual {
+		return fmt.Sprintf("%v://%v.%v/%v", scheme, conf.BucketName, conf.Endpoint, path)
+	}
+	return fmt.Sprintf("%v://%v/%v/%v", scheme, conf.Endpoint, conf.BucketName, path)
+}
+
+// 文件名按路径逐段转义，保留目录分隔符
+func escapeKey(key string) string {
+	parts := strings.Split(strings.TrimLeft(key, "/"), "/")
+	for i, part := range parts {
+		parts[i] = url.PathEscape(part)
+	}
+	return strings.Join(parts, "/")
+}
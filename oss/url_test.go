@@ -0,0 +1,32 @@
+package oss
+
+import (
+	"testing"
+	"web-wechat/core"
+)
+
+func TestGetUrl(t *testing.T) {
+	old, oldStorage := core.SystemConfig.OssConfig, storage
+	defer func() { core.SystemConfig.OssConfig, storage = old, oldStorage }()
+
+	storage = &minioStorage{}
+	conf := &core.SystemConfig.OssConfig
+	conf.Endpoint, conf.BucketName, conf.UseSsl = "oss.example.com", "wechat", false
+	if u := GetUrl("123/文件 1.png"); u != "http://oss.example.com/wechat/123/%E6%96%87%E4%BB%B6%201.png" {
+		t.Fatalf("path格式链接错误: %v", u)
+	}
+	conf.UseSsl, conf.UrlStyle = true, UrlStyleVirtual
+	if u := GetUrl("123/1.png"); u != "https://wechat.oss.example.com/123/1.png" {
+		t.Fatalf("virtual格式链接错误: %v", u)
+	}
+	conf.PublicUrl = "https://cdn.example.com/"
+	if u := GetUrl("123/1.png"); u != "https://cdn.example.com/123/1.png" {
+		t.Fatalf("publicUrl链接错误: %v", u)
+	}
+	// 本地存储没有配置publicUrl的时候没有链接
+	conf.PublicUrl = ""
+	storage = NewMemoryStorage()
+	if u := GetUrl("123/1.png"); u != "" {
+		t.Fatalf("内存存储不应该有链接: %v", u)
+	}
+}
@@ -0,0 +1,128 @@
+package plugins
+
+import (
+	"errors"
+	"fmt"
+	"github.com/eatmoreapple/openwechat"
+	"strings"
+	"web-wechat/core"
+	"web-wechat/utils"
+)
+
+// AdminPlugin 管理机器人的管理员，添加和删除只有登录的微信自己可以使用
+type AdminPlugin struct {
+	CommandPlugin
+}
+
+func (AdminPlugin) Name() string        { return "admin" }
+func (AdminPlugin) Description() string { return "添加、删除管理员" }
+func (AdminPlugin) RequiredRole() Role  { return RoleAdmin }
+
+func (p AdminPlugin) Commands() []Command {
+	return []Command{
+		{Name: "添加管理员", Aliases: []string{"addadmin"}, Usage: "[昵称]", Description: "添加管理员，群里填群成员的昵称，私聊不填为对方", Role: RoleOwner, Handler: p.add},
+		{Name: "删除管理员", Aliases: []string{"deladmin"}, Usage: "[昵称]", Description: "删除管理员，群里填群成员的昵称，私聊不填为对方", Role: RoleOwner, Handler: p.remove},
+		{Name: "管理员列表", Aliases: []string{"admins"}, Description: "查看所有管理员", Handler: p.list},
+	}
+}
+
+func (p AdminPlugin) add(c *CommandContext) error {
+	return p.change(c, true)
+}
+
+func (p AdminPlugin) remove(c *CommandContext) error {
+	return p.change(c, false)
+}
+
+// 添加或删除管理员
+func (p AdminPlugin) change(c *CommandContext, add bool) error {
+	if len(c.Args) > 1 {
+		return ErrUsage
+	}
+	var name string
+	if len(c.Args) == 1 {
+		name = strings.TrimPrefix(c.Args[0], "@")
+	}
+	user, err := findCommandUser(c.MessageContext, name)
+	if err != nil {
+		_, _ = replyText(c.MessageContext, p.Name(), err.Error())
+		return nil
+	}
+	appKey := core.AppKeyFromContext(c.Bot().Context())
+	action := "添加管理员"
+	if add {
+		err = addAdmin(appKey, user)
+	} else {
+		action = "删除管理员"
+		err = removeAdmin(appKey, utils.GetUserId(user))
+	}
+	if errors.Is(err, errNoStableId) {
+		_, _ = replyText(c.MessageContext, p.Name(), fmt.Sprintf("无法添加[%v]: %v", user.NickName, err.Error()))
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	_, _ = replyText(c.MessageContext, p.Name(), fmt.Sprintf("已%v: %v", action, user.NickName))
+	return nil
+}
+
+// 查看管理员
+func (p AdminPlugin) list(c *CommandContext) error {
+	admins, err := listAdmins(core.AppKeyFromContext(c.Bot().Context()))
+	if err != nil {
+		return err
+	}
+	reply := "还没有管理员"
+	if len(admins) > 0 {
+		lines := []string{"管理员:"}
+		for id, nickName := range admins {
+			lines = append(lines, fmt.Sprintf("%v(%v)", nickName, id))
+		}
+		reply = strings.Join(lines, "\n")
+	}
+	_, _ = replyText(c.MessageContext, p.Name(), reply)
+	return nil
+}
+
+// 根据名称查找指令里的用户，群里按群昵称和昵称查找群成员，私聊按备注和昵称查找好友，私聊不填名称的时候为对方
+func findCommandUser(ctx *openwechat.MessageContext, name string) (*openwechat.User, error) {
+	chat, err := messageChat(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if name == "" {
+		if chat.IsGroup() {
+			return nil, errors.New("请在指令后面加上群成员的昵称")
+		}
+		return chat, nil
+	}
+	if chat.IsGroup() {
+		members, err := (&openwechat.Group{User: chat}).Members()
+		if err != nil {
+			return nil, err
+		}
+		result := members.Search(1, func(user *openwechat.User) bool {
+			return user.DisplayName == name || user.NickName == name
+		})
+		if result.Count() > 0 {
+			return result.First(), nil
+		}
+		return nil, fmt.Errorf("群里没有找到[%v]", name)
+	}
+	self, err := ctx.Bot().GetCurrentUser()
+	if err != nil {
+		return nil, err
+	}
+	friends, err := self.Friends()
+	if err != nil {
+		return nil, err
+	}
+	result := friends.Search(1, func(friend *openwechat.Friend) bool {
+		return friend.RemarkName == name || friend.NickName == name || utils.GetUserId(friend.User) == name
+	})
+	if result.Count() > 0 {
+		return result.First().User, nil
+	}
+	return nil, fmt.Errorf("没有找到好友[%v]", name)
+}
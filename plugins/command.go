@@ -1,23 +1,236 @@
 package plugins
 
 import (
+	"errors"
+	"fmt"
+	"gitee.ltd/lxh/logger/log"
 	"github.com/eatmoreapple/openwechat"
+	"strings"
+	"unicode"
+	"web-wechat/core"
 )
 
-// Command
-// @description:
-// @receiver weChatPlugin
-// @param ctx
-func (p weChatPlugin) Command(ctx *openwechat.MessageContext) {
-	if PluginSwitch {
-		switch ctx.Content {
-		case "放假倒计时":
-			p.checkHoliday(ctx)
-		case "过节倒计时":
-			p.checkFestivals(ctx)
-		case "下班倒计时":
-			p.checkOffWork(ctx)
+// ErrUsage 指令参数错误，指令框架会回复指令的用法
+var ErrUsage = errors.New("指令参数错误")
+
+// 群里@人的时候名字后面跟的特殊空格
+const mentionSpace = "\u2005"
+
+// Command 插件指令
+type Command struct {
+	Name        string                        // 指令名称
+	Aliases     []string                      // 别名
+	Usage       string                        // 参数说明，比如 <昵称>，没有参数不填
+	Description string                        // 指令说明，显示在帮助里
+	Role        Role                          // 需要的角色，和插件需要的角色取更高的那个
+	Handler     func(c *CommandContext) error // 处理指令，返回ErrUsage的时候回复指令的用法
+}
+
+// Commander 提供指令的插件，指令由指令框架解析和分发
+type Commander interface {
+	Commands() []Command
+}
+
+// CommandPlugin 只处理指令的插件可以嵌入这个结构体，不需要再实现Match、Handle、Init和Shutdown
+type CommandPlugin struct{}
+
+func (CommandPlugin) Match(*openwechat.MessageContext) bool { return false }
+func (CommandPlugin) Handle(*openwechat.MessageContext)     {}
+func (CommandPlugin) Init() error                           { return nil }
+func (CommandPlugin) Shutdown()                             {}
+
+// CommandContext 指令上下文
+type CommandContext struct {
+	*openwechat.MessageContext
+	Name   string   // 发出的指令名称，可能是别名
+	Args   []string // 解析好的参数，引号里的内容是一个参数
+	Raw    string   // 指令名称后面的原始内容，保留换行
+	Prefix string   // 指令前缀
+
+	caller *caller
+	chat   *chatSwitch
+}
+
+// 消息里解析出来的指令
+type commandCall struct {
+	name    string
+	args    []string
+	argsErr error // 参数解析错误，找到指令之后才提示
+	raw     string
+}
+
+// 指令前缀，不配置的时候不需要前缀
+func commandPrefix() string {
+	return core.SystemConfig.PluginConfig.Prefix
+}
+
+// 解析消息里的指令，不是指令的时候返回nil
+// 群里@机器人的时候去掉@，这时候可以不加前缀
+func parseMessageCommand(ctx *openwechat.MessageContext) *commandCall {
+	if !ctx.IsText() {
+		return nil
+	}
+	content, mentioned := ctx.Content, false
+	if ctx.IsComeFromGroup() && ctx.IsAt() {
+		if name := botNameInGroup(ctx); name != "" {
+			content, mentioned = stripMention(content, name)
+		}
+	}
+	return parseCommand(content, commandPrefix(), mentioned)
+}
+
+// 机器人在群里显示的名字，有群昵称的时候是群昵称
+func botNameInGroup(ctx *openwechat.MessageContext) string {
+	group, err := ctx.Sender()
+	if err != nil {
+		return ""
+	}
+	self := group.MemberList.SearchByUserName(1, ctx.ToUserName)
+	if self.Count() == 0 {
+		return ""
+	}
+	if self.First().DisplayName != "" {
+		return self.First().DisplayName
+	}
+	return self.First().NickName
+}
+
+// 去掉内容里@机器人的部分，返回去掉之后的内容和是否@了机器人
+func stripMention(content, name string) (string, bool) {
+	at := "@" + name
+	for _, sep := range []string{mentionSpace, " "} {
+		if strings.Contains(content, at+sep) {
+			return strings.TrimSpace(strings.Replace(content, at+sep, "", 1)), true
+		}
+	}
+	// @在最后的时候后面没有空格
+	if strings.HasSuffix(content, at) {
+		return strings.TrimSpace(strings.TrimSuffix(content, at)), true
+	}
+	return content, false
+}
+
+// 解析指令，prefix不为空的时候必须以prefix开头，mentioned为true的时候前缀可以省略
+func parseCommand(content, prefix string, mentioned bool) *commandCall {
+	content = strings.TrimSpace(content)
+	if prefix != "" {
+		if strings.HasPrefix(content, prefix) {
+			content = strings.TrimPrefix(content, prefix)
+		} else if !mentioned {
+			return nil
+		}
+	}
+	name, raw := content, ""
+	if i := strings.IndexFunc(content, unicode.IsSpace); i >= 0 {
+		name, raw = content[:i], strings.TrimSpace(content[i:])
+	}
+	if name == "" {
+		return nil
+	}
+	call := &commandCall{name: name, raw: raw}
+	call.args, call.argsErr = splitArgs(raw)
+	return call
+}
+
+// 按空白分割参数，单引号、双引号和中文引号里的内容是一个参数，双引号里可以用反斜杠转义
+func splitArgs(s string) ([]string, error) {
+	var (
+		args    []string
+		current strings.Builder
+		quote   rune // 当前所在引号的结束符号，0为不在引号里
+		inArg   bool // 是否正在读取参数，用来保留空字符串参数
+		escaped bool
+	)
+	for _, r := range s {
+		switch {
+		case escaped:
+			current.WriteRune(r)
+			escaped = false
+		case quote != 0:
+			if r == '\\' && quote == '"' {
+				escaped = true
+			} else if r == quote {
+				quote = 0
+			} else {
+				current.WriteRune(r)
+			}
+		case r == '"' || r == '\'':
+			quote, inArg = r, true
+		case r == '“':
+			quote, inArg = '”', true
+		case unicode.IsSpace(r):
+			if inArg {
+				args = append(args, current.String())
+				current.Reset()
+				inArg = false
+			}
+		default:
+			current.WriteRune(r)
+			inArg = true
+		}
+	}
+	if quote != 0 || escaped {
+		return nil, errors.New("引号没有闭合")
+	}
+	if inArg {
+		args = append(args, current.String())
+	}
+	return args, nil
+}
+
+// 在插件里查找指令，名称和别名都可以，英文不区分大小写
+func findCommand(p Plugin, name string) *Command {
+	c, ok := p.(Commander)
+	if !ok {
+		return nil
+	}
+	for _, cmd := range c.Commands() {
+		if strings.EqualFold(cmd.Name, name) {
+			return &cmd
+		}
+		for _, alias := range cmd.Aliases {
+			if strings.EqualFold(alias, name) {
+				return &cmd
+			}
 		}
 	}
-	ctx.Next()
+	return nil
+}
+
+// 指令需要的角色
+func commandRole(p Plugin, cmd *Command) Role {
+	if role := requiredRole(p); role > cmd.Role {
+		return role
+	}
+	return cmd.Role
+}
+
+// 指令的用法
+func (cmd *Command) usage(prefix string) string {
+	text := prefix + cmd.Name
+	if cmd.Usage != "" {
+		text += " " + cmd.Usage
+	}
+	return text
+}
+
+// 执行指令，参数错误的时候回复用法，其他错误回复错误信息
+func runCommand(c *CommandContext, p Plugin, cmd *Command, call *commandCall) {
+	if !c.caller.allow(p.Name(), commandRole(p, cmd)) {
+		return
+	}
+	if call.argsErr != nil {
+		_, _ = replyText(c.MessageContext, p.Name(), call.argsErr.Error()+"\n用法: "+cmd.usage(c.Prefix))
+		return
+	}
+	err := cmd.Handler(c)
+	if err == nil {
+		return
+	}
+	if errors.Is(err, ErrUsage) {
+		_, _ = replyText(c.MessageContext, p.Name(), "用法: "+cmd.usage(c.Prefix))
+		return
+	}
+	log.Errorf("插件[%v]指令[%v]执行失败: %v", p.Name(), cmd.Name, err.Error())
+	_, _ = replyText(c.MessageContext, p.Name(), fmt.Sprintf("%v失败: %v", cmd.Name, err.Error()))
 }
@@ -0,0 +1,76 @@
+package plugins
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseCommand(t *testing.T) {
+	cases := []struct {
+		content   string
+		prefix    string
+		mentioned bool
+		name      string
+		args      []string
+	}{
+		{"/help", "/", false, "help", nil},
+		{"help", "/", false, "", nil},
+		{"help", "/", true, "help", nil},
+		{"下班倒计时", "", false, "下班倒计时", nil},
+		{"#添加管理员  @张三 ", "#", false, "添加管理员", []string{"@张三"}},
+		{`/gpt "hello world" 'a b' “你 好” c\d`, "/", false, "gpt", []string{"hello world", "a b", "你 好", `c\d`}},
+		{`/say "a \"b\"" ""`, "/", false, "say", []string{`a "b"`, ""}},
+		{"/", "/", false, "", nil},
+	}
+	for _, c := range cases {
+		call := parseCommand(c.content, c.prefix, c.mentioned)
+		if c.name == "" {
+			if call != nil {
+				t.Errorf("%q 不应该解析为指令: %+v", c.content, call)
+			}
+			continue
+		}
+		if call == nil || call.name != c.name || call.argsErr != nil || !reflect.DeepEqual(call.args, c.args) {
+			t.Errorf("%q 解析结果错误: %+v", c.content, call)
+		}
+	}
+
+	// 引号没有闭合
+	if call := parseCommand(`/gpt "hello`, "/", false); call == nil || call.argsErr == nil {
+		t.Fatalf("引号没有闭合应该返回错误: %+v", call)
+	}
+	// 保留原始内容里的换行
+	if call := parseCommand("/gpt 第一行\n第二行", "/", false); call == nil || call.raw != "第一行\n第二行" {
+		t.Fatalf("原始内容错误: %+v", call)
+	}
+}
+
+func TestStripMention(t *testing.T) {
+	cases := []struct {
+		content   string
+		want      string
+		mentioned bool
+	}{
+		{"@机器人 /help", "/help", true},
+		{"下班倒计时 @机器人", "下班倒计时", true},
+		{"@机器人 帮助", "帮助", true},
+		{"@别人 /help", "@别人 /help", false},
+	}
+	for _, c := range cases {
+		if got, mentioned := stripMention(c.content, "机器人"); got != c.want || mentioned != c.mentioned {
+			t.Errorf("%q 结果错误: %q %v", c.content, got, mentioned)
+		}
+	}
+}
+
+func TestFindCommand(t *testing.T) {
+	if cmd := findCommand(HolidayPlugin{}, "HOLIDAY"); cmd == nil || cmd.Name != "放假倒计时" {
+		t.Fatalf("别名应该不区分大小写: %+v", cmd)
+	}
+	if findCommand(&OpenGptPlugin{}, "holiday") != nil {
+		t.Fatal("不应该找到其他插件的指令")
+	}
+	if commandRole(AdminPlugin{}, findCommand(AdminPlugin{}, "addadmin")) != RoleOwner {
+		t.Fatal("指令的角色高于插件的角色时使用指令的角色")
+	}
+}
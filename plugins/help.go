@@ -0,0 +1,71 @@
+package plugins
+
+import (
+	"fmt"
+	"strings"
+)
+
+// 帮助插件名称
+const helpPluginName = "help"
+
+// HelpPlugin 列出发出指令的人可以使用的指令，当前会话关闭的插件不显示
+type HelpPlugin struct {
+	CommandPlugin
+}
+
+func (HelpPlugin) Name() string        { return helpPluginName }
+func (HelpPlugin) Description() string { return "查看可以使用的指令" }
+
+func (p HelpPlugin) Commands() []Command {
+	return []Command{
+		{Name: "help", Aliases: []string{"帮助"}, Usage: "[指令]", Description: "查看可以使用的指令，指定指令的时候查看这个指令的用法", Handler: p.help},
+	}
+}
+
+func (p HelpPlugin) help(c *CommandContext) error {
+	if len(c.Args) > 1 {
+		return ErrUsage
+	}
+	role := c.caller.getRole()
+	var lines []string
+	for _, plugin := range Plugins() {
+		if !alwaysOnPlugins[plugin.Name()] && !c.chat.enabled(plugin.Name()) {
+			continue
+		}
+		// 查看单个指令的用法
+		if len(c.Args) == 1 {
+			if cmd := findCommand(plugin, c.Args[0]); cmd != nil && commandRole(plugin, cmd) <= role {
+				_, _ = replyText(c.MessageContext, p.Name(), cmd.detail(c.Prefix, commandRole(plugin, cmd)))
+				return nil
+			}
+			continue
+		}
+		commander, ok := plugin.(Commander)
+		if !ok {
+			continue
+		}
+		for _, cmd := range commander.Commands() {
+			if commandRole(plugin, &cmd) <= role {
+				lines = append(lines, fmt.Sprintf("%v - %v", cmd.usage(c.Prefix), cmd.Description))
+			}
+		}
+	}
+	if len(c.Args) == 1 {
+		_, _ = replyText(c.MessageContext, p.Name(), fmt.Sprintf("没有找到指令[%v]", c.Args[0]))
+		return nil
+	}
+	_, _ = replyText(c.MessageContext, p.Name(), "可以使用的指令:\n"+strings.Join(lines, "\n"))
+	return nil
+}
+
+// 指令的详细说明
+func (cmd *Command) detail(prefix string, role Role) string {
+	lines := []string{"用法: " + cmd.usage(prefix), cmd.Description}
+	if len(cmd.Aliases) > 0 {
+		lines = append(lines, "别名: "+strings.Join(cmd.Aliases, "、"))
+	}
+	if role > RoleMember {
+		lines = append(lines, "需要权限: "+role.String())
+	}
+	return strings.Join(lines, "\n")
+}
@@ -7,11 +7,32 @@ import (
 	"web-wechat/utils"
 )
 
+// HolidayPlugin 放假倒计时和过节倒计时
+type HolidayPlugin struct {
+	CommandPlugin
+}
+
+func (HolidayPlugin) Name() string        { return "holiday" }
+func (HolidayPlugin) Description() string { return "放假倒计时、过节倒计时" }
+
+func (p HolidayPlugin) Commands() []Command {
+	return []Command{
+		{Name: "放假倒计时", Aliases: []string{"holiday"}, Description: "距离最近的节假日或者周末还有几天", Handler: func(c *CommandContext) error {
+			p.checkHoliday(c.MessageContext)
+			return nil
+		}},
+		{Name: "过节倒计时", Aliases: []string{"festival"}, Description: "距离最近的节日还有几天", Handler: func(c *CommandContext) error {
+			p.checkFestivals(c.MessageContext)
+			return nil
+		}},
+	}
+}
+
 // checkHoliday
 // @description: 放假倒计时
-// @receiver weChatPlugin
+// @receiver HolidayPlugin
 // @param ctx
-func (weChatPlugin) checkHoliday(ctx *openwechat.MessageContext) {
+func (p HolidayPlugin) checkHoliday(ctx *openwechat.MessageContext) {
 	dd := []string{"今天", "明天", "后天"}
 	// 获取最近的节假日或周末
 	d, t := utils.OffDuty().GetNextHolidayOrWeekend()
@@ -22,17 +43,16 @@ func (weChatPlugin) checkHoliday(ctx *openwechat.MessageContext) {
 	if t > 0 && t < 3 {
 		replyStr = fmt.Sprintf("%v就是%v啦，再坚持一下咯~", dd[t], d)
 	}
-	if _, err := ctx.ReplyText(replyStr); err != nil {
+	if _, err := replyText(ctx, p.Name(), replyStr); err != nil {
 		log.Errorf("[放假倒计时]消息回复失败: %v", err.Error())
 	}
-	ctx.Next()
 }
 
 // checkFestivals
 // @description: 过节倒计时
-// @receiver weChatPlugin
+// @receiver HolidayPlugin
 // @param ctx
-func (weChatPlugin) checkFestivals(ctx *openwechat.MessageContext) {
+func (p HolidayPlugin) checkFestivals(ctx *openwechat.MessageContext) {
 	dd := []string{"今天", "明天", "后天"}
 	// 获取最近的节假日或周末
 	d, t := utils.OffDuty().GetNextHoliday()
@@ -46,8 +66,7 @@ func (weChatPlugin) checkFestivals(ctx *openwechat.MessageContext) {
 	if t > 0 && t < 3 {
 		replyStr = fmt.Sprintf("%v就是%v啦，再坚持一下咯~", dd[t], d)
 	}
-	if _, err := ctx.ReplyText(replyStr); err != nil {
+	if _, err := replyText(ctx, p.Name(), replyStr); err != nil {
 		log.Errorf("[过节倒计时]消息回复失败: %v", err.Error())
 	}
-	ctx.Next()
 }
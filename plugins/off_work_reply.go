@@ -10,21 +10,38 @@ import (
 	"web-wechat/utils"
 )
 
+// OffWorkPlugin 下班倒计时
+type OffWorkPlugin struct {
+	CommandPlugin
+}
+
+func (OffWorkPlugin) Name() string        { return "off_work" }
+func (OffWorkPlugin) Description() string { return "下班倒计时" }
+
+func (p OffWorkPlugin) Commands() []Command {
+	return []Command{
+		{Name: "下班倒计时", Aliases: []string{"offwork"}, Description: "距离下班还有多久", Handler: func(c *CommandContext) error {
+			p.checkOffWork(c.MessageContext)
+			return nil
+		}},
+	}
+}
+
 // checkOffWork
 // @description: 下班倒计时
-// @receiver weChatPlugin
+// @receiver OffWorkPlugin
 // @param ctx
-func (weChatPlugin) checkOffWork(ctx *openwechat.MessageContext) {
+func (p OffWorkPlugin) checkOffWork(ctx *openwechat.MessageContext) {
 	// 如果不是工作日，跳过处理
 	if isHoliday, h := utils.OffDuty().CheckIsHoliday(time.Now()); isHoliday {
-		if _, err := ctx.ReplyText(fmt.Sprintf("不会吧不会吧，不会有人%v还在上班吧", h)); err != nil {
+		if _, err := replyText(ctx, p.Name(), fmt.Sprintf("不会吧不会吧，不会有人%v还在上班吧", h)); err != nil {
 			log.Errorf("阴阳怪气失败: %v", err.Error())
 		}
 		return
 	}
 	// 非工作时间不执行
 	if time.Now().Hour() < 9 || time.Now().Hour() >= 18 {
-		if _, err := ctx.ReplyText("不会吧不会吧，不会有人这个点还没下班吧"); err != nil {
+		if _, err := replyText(ctx, p.Name(), "不会吧不会吧，不会有人这个点还没下班吧"); err != nil {
 			log.Errorf("阴阳怪气失败: %v", err.Error())
 		}
 		return
@@ -41,8 +58,7 @@ func (weChatPlugin) checkOffWork(ctx *openwechat.MessageContext) {
 	car := carbon.SetLanguage(lange)
 	offDutyTime := car.Now().StartOfDay().AddHours(18)
 	now := car.Now()
-	if _, err := ctx.ReplyText("距离下班还有 " + now.DiffInString(offDutyTime)); err != nil {
+	if _, err := replyText(ctx, p.Name(), "距离下班还有 "+now.DiffInString(offDutyTime)); err != nil {
 		log.Errorf("下班时间倒计时发送失败: %v", err.Error())
 	}
-	ctx.Next()
 }
@@ -12,50 +12,72 @@ import (
 	"web-wechat/core"
 )
 
-// OpenGPT
-// @description: 开放式GPT-3聊天机器人
-// @receiver weChatPlugin
-// @param ctx
-func (weChatPlugin) OpenGPT(ctx *openwechat.MessageContext) {
-	conf := core.SystemConfig.OpenAiConfig
-	// 判断是否开启了GPT-3聊天机器人
-	if !conf.Enable {
-		return
-	}
+// 引用消息的分隔符
+const quoteSeparator = "\n- - - - - - - - - - - - - - -\n"
 
-	msg := ctx.Content
-
-	// 判断是不是引用消息
-	//var beforeMsg string
-	if strings.HasPrefix(ctx.Content, "「") && strings.Contains(ctx.Content, "\n- - - - - - - - - - - - - - -\n") {
-		// 提取出前文
-		//beforeMsg = strings.Split(ctx.Content, "\n- - - - - - - - - - - - - - -\n")[0]
-		msg = strings.Split(ctx.Content, "\n- - - - - - - - - - - - - - -\n")[1]
-	}
-
-	// 取出消息第一行以及剩下的内容
-	msgArray := strings.Split(msg, "\n")
-	if len(msgArray) < 2 || strings.ToLower(msgArray[0]) != "@openai" {
-		return
-	}
-	// 获取提问的内容
-	question := strings.Join(msgArray[1:], "\n")
+// OpenGptPlugin
+// @description: 开放式GPT-3聊天机器人，消息第一行为@openai的时候把剩下的内容作为问题
+type OpenGptPlugin struct {
+	client gpt3.Client
+}
 
-	log.Debugf("ChatGPT提问内容: %s", question)
+func (*OpenGptPlugin) Name() string { return "open_gpt" }
+func (*OpenGptPlugin) Description() string {
+	return "ChatGPT聊天机器人，第一行发送@openai，第二行开始是问题"
+}
+func (*OpenGptPlugin) Shutdown() {}
 
-	// 调用GPT-3聊天机器人
+// Init 创建OpenAI客户端
+func (p *OpenGptPlugin) Init() error {
+	conf := core.SystemConfig.OpenAiConfig
 	// 如果配置了代理，就设置一下
 	hc := http.Client{Timeout: 30 * time.Second}
 	if conf.Proxy != "" {
-		hc.Transport = &http.Transport{
-			Proxy: func(req *http.Request) (*url.URL, error) {
-				return url.Parse(conf.Proxy)
-			},
+		proxy, err := url.Parse(conf.Proxy)
+		if err != nil {
+			return err
 		}
+		hc.Transport = &http.Transport{Proxy: http.ProxyURL(proxy)}
 	}
+	p.client = gpt3.NewClient(conf.ApiKey, gpt3.WithHTTPClient(&hc))
+	return nil
+}
 
-	// 创建OpenAI客户端
-	client := gpt3.NewClient(conf.ApiKey, gpt3.WithHTTPClient(&hc))
+// Match 判断是否开启了GPT-3聊天机器人并且是提问消息
+func (*OpenGptPlugin) Match(ctx *openwechat.MessageContext) bool {
+	if !core.SystemConfig.OpenAiConfig.Enable {
+		return false
+	}
+	_, ok := openGptQuestion(ctx.Content)
+	return ok
+}
+
+// Commands 也可以用指令提问，没有开启的时候不提供指令
+func (p *OpenGptPlugin) Commands() []Command {
+	if !core.SystemConfig.OpenAiConfig.Enable {
+		return nil
+	}
+	return []Command{
+		{Name: "gpt", Aliases: []string{"chatgpt"}, Usage: "<问题>", Description: "向ChatGPT提问", Handler: func(c *CommandContext) error {
+			if c.Raw == "" {
+				return ErrUsage
+			}
+			p.ask(c.MessageContext, c.Raw)
+			return nil
+		}},
+	}
+}
+
+// Handle 回答第一行为@openai的消息
+func (p *OpenGptPlugin) Handle(ctx *openwechat.MessageContext) {
+	// 获取提问的内容
+	question, _ := openGptQuestion(ctx.Content)
+	p.ask(ctx, question)
+}
+
+// 调用GPT-3聊天机器人回答问题
+func (p *OpenGptPlugin) ask(ctx *openwechat.MessageContext, question string) {
+	log.Debugf("ChatGPT提问内容: %s", question)
 
 	// 组装消息 TODO 懒得搞上下文联动，有想法的可以自己实现，只需要组装一下下面这个Message字段就行了，把之前的记录带过去
 	request := gpt3.ChatCompletionRequest{
@@ -63,12 +85,27 @@ func (weChatPlugin) OpenGPT(ctx *openwechat.MessageContext) {
 		Messages: []gpt3.ChatCompletionRequestMessage{{Role: "user", Content: question}},
 	}
 	// 调用聊天机器人
-	resp, err := client.ChatCompletion(context.Background(), request)
+	resp, err := p.client.ChatCompletion(context.Background(), request)
 	if err != nil {
-		_, _ = ctx.ReplyText("ChatGPT AI 引擎出错了\n" + err.Error())
+		_, _ = replyText(ctx, p.Name(), "ChatGPT AI 引擎出错了\n"+err.Error())
 		return
 	}
 	log.Debugf("ChatGPT回答内容: %s", resp.Choices[0].Message.Content)
 	// 发送回复
-	_, _ = ctx.ReplyText(resp.Choices[0].Message.Content)
+	_, _ = replyText(ctx, p.Name(), resp.Choices[0].Message.Content)
+}
+
+// 取出提问的内容，消息第一行不是@openai的时候返回false
+func openGptQuestion(content string) (string, bool) {
+	msg := content
+	// 判断是不是引用消息，是的话去掉前文
+	if strings.HasPrefix(content, "「") && strings.Contains(content, quoteSeparator) {
+		msg = strings.SplitN(content, quoteSeparator, 2)[1]
+	}
+	// 取出消息第一行以及剩下的内容
+	msgArray := strings.Split(msg, "\n")
+	if len(msgArray) < 2 || strings.ToLower(msgArray[0]) != "@openai" {
+		return "", false
+	}
+	return strings.Join(msgArray[1:], "\n"), true
 }
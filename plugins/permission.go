@@ -0,0 +1,140 @@
+package plugins
+
+import (
+	"errors"
+	"fmt"
+	"gitee.ltd/lxh/logger/log"
+	"github.com/eatmoreapple/openwechat"
+	"web-wechat/core"
+	. "web-wechat/db"
+)
+
+// Role 使用插件需要的角色
+type Role int
+
+const (
+	RoleMember Role = iota // 所有人
+	RoleAdmin              // 管理员
+	RoleOwner              // 登录的微信自己
+)
+
+// 配置里的角色名称
+var roleNames = map[string]Role{
+	"member": RoleMember,
+	"admin":  RoleAdmin,
+	"owner":  RoleOwner,
+}
+
+func (r Role) String() string {
+	switch r {
+	case RoleAdmin:
+		return "管理员"
+	case RoleOwner:
+		return "机器人主人"
+	default:
+		return "所有人"
+	}
+}
+
+// RoleRequirer 插件默认需要的角色，没有实现这个接口的插件所有人都可以使用
+type RoleRequirer interface {
+	RequiredRole() Role
+}
+
+// 插件需要的角色，配置优先于插件默认的角色
+func requiredRole(p Plugin) Role {
+	if name, ok := core.SystemConfig.PluginConfig.Roles[p.Name()]; ok {
+		if role, ok := roleNames[name]; ok {
+			return role
+		}
+	}
+	if r, ok := p.(RoleRequirer); ok {
+		return r.RequiredRole()
+	}
+	return RoleMember
+}
+
+// 生成保存管理员的Redis Key，每个AppKey一个Hash，字段为用户ID，值为昵称
+func adminKey(appKey string) string {
+	return "wechat:admin:" + appKey
+}
+
+// 发出指令的人，群消息为群里的发信人
+func messageTrigger(ctx *openwechat.MessageContext) (*openwechat.User, error) {
+	if ctx.IsComeFromGroup() && !ctx.IsSendBySelf() {
+		return ctx.SenderInGroup()
+	}
+	return ctx.Sender()
+}
+
+// 发出指令的人的角色，自己发出的消息为机器人主人
+func callerRole(ctx *openwechat.MessageContext) (Role, error) {
+	if ctx.IsSendBySelf() {
+		return RoleOwner, nil
+	}
+	trigger, err := messageTrigger(ctx)
+	if err != nil {
+		return RoleMember, err
+	}
+	admins, err := listAdmins(core.AppKeyFromContext(ctx.Bot().Context()))
+	if err != nil {
+		return RoleMember, err
+	}
+	// 没有固定ID的人不可能是管理员，UserName每次登录都会变，不能用来判断
+	if id := trigger.ID(); id != "" {
+		if _, ok := admins[id]; ok {
+			return RoleAdmin, nil
+		}
+	}
+	return RoleMember, nil
+}
+
+// 发出指令的人，角色在需要的时候才查询
+type caller struct {
+	ctx    *openwechat.MessageContext
+	role   Role
+	loaded bool
+}
+
+// 获取发出指令的人的角色，查询失败的时候当作普通成员
+func (c *caller) getRole() Role {
+	if !c.loaded {
+		role, err := callerRole(c.ctx)
+		if err != nil {
+			log.Errorf("获取指令发出人的角色失败: %v", err.Error())
+		}
+		c.role, c.loaded = role, true
+	}
+	return c.role
+}
+
+// 判断是否有权限，没有权限的时候回复拒绝
+func (c *caller) allow(plugin string, required Role) bool {
+	if required <= RoleMember || c.getRole() >= required {
+		return true
+	}
+	_, _ = replyText(c.ctx, plugin, fmt.Sprintf("没有权限，只有%v可以使用这个指令", required))
+	return false
+}
+
+// 获取AppKey的管理员，用户ID => 昵称
+func listAdmins(appKey string) (map[string]string, error) {
+	return RedisClient.HGetAll(adminKey(appKey))
+}
+
+// 没有固定ID的用户不能设为管理员
+var errNoStableId = errors.New("获取不到固定ID，不是好友的群成员需要先加为好友才能设为管理员")
+
+// 添加管理员，只能用多次登录不变的ID，获取不到的时候返回errNoStableId
+func addAdmin(appKey string, user *openwechat.User) error {
+	id := user.ID()
+	if id == "" {
+		return errNoStableId
+	}
+	return RedisClient.HSet(adminKey(appKey), id, user.NickName)
+}
+
+// 删除管理员
+func removeAdmin(appKey, userId string) error {
+	return RedisClient.HDel(adminKey(appKey), userId)
+}
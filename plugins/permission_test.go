@@ -0,0 +1,33 @@
+package plugins
+
+import (
+	"errors"
+	"github.com/eatmoreapple/openwechat"
+	"testing"
+	"web-wechat/core"
+)
+
+func TestRequiredRole(t *testing.T) {
+	old := core.SystemConfig.PluginConfig.Roles
+	defer func() { core.SystemConfig.PluginConfig.Roles = old }()
+
+	core.SystemConfig.PluginConfig.Roles = nil
+	if requiredRole(StatusPlugin{}) != RoleAdmin || requiredRole(HolidayPlugin{}) != RoleMember {
+		t.Fatal("没有配置的时候使用插件默认的角色")
+	}
+	core.SystemConfig.PluginConfig.Roles = map[string]string{"status": "owner", "holiday": "admin", "off_work": "unknown"}
+	if requiredRole(StatusPlugin{}) != RoleOwner || requiredRole(HolidayPlugin{}) != RoleAdmin {
+		t.Fatal("配置的角色优先于插件默认的角色")
+	}
+	if requiredRole(OffWorkPlugin{}) != RoleMember {
+		t.Fatal("配置错误的角色应该使用插件默认的角色")
+	}
+}
+
+func TestAddAdminWithoutStableId(t *testing.T) {
+	// 不是好友的群成员只有每次登录都会变的UserName
+	member := &openwechat.User{UserName: "@abc", NickName: "群成员"}
+	if err := addAdmin("test", member); !errors.Is(err, errNoStableId) {
+		t.Fatalf("没有固定ID的时候不能添加管理员，实际: %v", err)
+	}
+}
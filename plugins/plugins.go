@@ -1,28 +1,41 @@
 package plugins
 
-import "github.com/eatmoreapple/openwechat"
+import (
+	"github.com/eatmoreapple/openwechat"
+	"web-wechat/core"
+	"web-wechat/event"
+	"web-wechat/utils"
+)
 
-var PluginSwitch = false
-
-type weChatPlugin struct {
-	isOpen bool
+// Plugin 插件接口，新插件在单独的文件里实现，然后在HandleMessage里注册
+type Plugin interface {
+	// Name 插件名称，不能重复，会记录在插件发出的消息来源里
+	Name() string
+	// Description 插件说明
+	Description() string
+	// Match 是否需要处理这条消息
+	Match(ctx *openwechat.MessageContext) bool
+	// Handle 处理消息，不需要调用ctx.Next()
+	Handle(ctx *openwechat.MessageContext)
+	// Init 注册的时候初始化，返回错误的插件不会注册
+	Init() error
+	// Shutdown 程序退出的时候释放资源
+	Shutdown()
 }
 
-var WeChatPluginInstance *weChatPlugin
-
-func init() {
-	if WeChatPluginInstance == nil {
-		WeChatPluginInstance = &weChatPlugin{false}
+// 插件回复文本消息，并发布消息发出事件，plugin为插件名称
+func replyText(ctx *openwechat.MessageContext, plugin, content string) (*openwechat.SentMessage, error) {
+	sent, err := ctx.ReplyText(content)
+	// 回复的对象是消息所在的会话，群消息为群组，自己发出的消息回复给原来的收信人
+	receiver, e := messageChat(ctx)
+	if e == nil {
+		// 触发者是发出指令的人，群消息取群里的发信人
+		trigger := receiver
+		if user, e := messageTrigger(ctx); e == nil {
+			trigger = user
+		}
+		origin := event.Origin{Source: event.SourcePlugin, Name: plugin, Trigger: utils.GetUserId(trigger), TriggerMsgId: ctx.MsgId}
+		event.PublishSent(core.AppKeyFromContext(ctx.Bot().Context()), receiver, content, sent, err, origin)
 	}
-}
-
-// ChangePluginStatus 修改插件状态
-func ChangePluginStatus(isOpen bool) {
-	WeChatPluginInstance = &weChatPlugin{isOpen}
-	PluginSwitch = isOpen
-}
-
-// CheckIsOpen 检查是否开启微信插件
-func (p weChatPlugin) CheckIsOpen(message *openwechat.Message) bool {
-	return p.isOpen
+	return sent, err
 }
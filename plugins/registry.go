@@ -0,0 +1,97 @@
+package plugins
+
+import (
+	"gitee.ltd/lxh/logger/log"
+	"github.com/eatmoreapple/openwechat"
+	"sync"
+)
+
+// 已注册的插件
+var (
+	registry     = make(map[string]Plugin)
+	pluginList   []Plugin // 按注册顺序保存，处理消息的时候按这个顺序调用
+	registryLock sync.RWMutex
+)
+
+// Register 注册插件，同名的插件只会注册一次，每个微信登录的时候重复调用不会重复初始化
+func Register(list ...Plugin) {
+	registryLock.Lock()
+	defer registryLock.Unlock()
+	for _, p := range list {
+		if _, exist := registry[p.Name()]; exist {
+			continue
+		}
+		if err := p.Init(); err != nil {
+			log.Errorf("插件[%v]初始化失败，不注册: %v", p.Name(), err.Error())
+			continue
+		}
+		registry[p.Name()] = p
+		pluginList = append(pluginList, p)
+		log.Infof("插件[%v]注册成功", p.Name())
+	}
+}
+
+// Plugins 获取已注册的插件，按注册顺序排列
+func Plugins() []Plugin {
+	registryLock.RLock()
+	defer registryLock.RUnlock()
+	return append([]Plugin(nil), pluginList...)
+}
+
+// GetPlugin 根据名称获取插件，没有注册的时候返回nil
+func GetPlugin(name string) Plugin {
+	registryLock.RLock()
+	defer registryLock.RUnlock()
+	return registry[name]
+}
+
+// Shutdown 关闭所有插件
+func Shutdown() {
+	registryLock.Lock()
+	defer registryLock.Unlock()
+	for i := len(pluginList) - 1; i >= 0; i-- {
+		pluginList[i].Shutdown()
+	}
+	registry = make(map[string]Plugin)
+	pluginList = nil
+}
+
+// CheckIsPluginMessage 所有消息都交给插件判断，插件自己的Match决定是否处理
+func CheckIsPluginMessage(message *openwechat.Message) bool {
+	return true
+}
+
+// 不能关闭的插件
+var alwaysOnPlugins = map[string]bool{
+	statusPluginName: true,
+	helpPluginName:   true,
+}
+
+// HandleMessage 把消息交给插件处理，插件开关按AppKey和会话区分，插件开关指令和帮助不能关闭
+// 消息是指令的时候交给提供这个指令的插件，其他消息交给Match匹配的插件
+// 插件需要管理员权限的时候，没有权限的人发出的指令会收到拒绝的回复
+func HandleMessage(ctx *openwechat.MessageContext) {
+	s, err := loadChatSwitch(ctx)
+	if err != nil {
+		log.Errorf("读取插件开关失败，使用默认开关: %v", err.Error())
+		s = &chatSwitch{}
+	}
+	c := &caller{ctx: ctx}
+	call := parseMessageCommand(ctx)
+	for _, p := range Plugins() {
+		if !alwaysOnPlugins[p.Name()] && !s.enabled(p.Name()) {
+			continue
+		}
+		if call != nil {
+			if cmd := findCommand(p, call.name); cmd != nil {
+				cc := &CommandContext{MessageContext: ctx, Name: call.name, Args: call.args, Raw: call.raw, Prefix: commandPrefix(), caller: c, chat: s}
+				runCommand(cc, p, cmd, call)
+				continue
+			}
+		}
+		if p.Match(ctx) && c.allow(p.Name(), requiredRole(p)) {
+			p.Handle(ctx)
+		}
+	}
+	ctx.Next()
+}
@@ -0,0 +1,40 @@
+package plugins
+
+import (
+	"errors"
+	"github.com/eatmoreapple/openwechat"
+	"testing"
+)
+
+type testPlugin struct {
+	name    string
+	initErr error
+	inits   *int
+}
+
+func (p testPlugin) Name() string                          { return p.name }
+func (p testPlugin) Description() string                   { return "测试插件" }
+func (p testPlugin) Match(*openwechat.MessageContext) bool { return false }
+func (p testPlugin) Handle(*openwechat.MessageContext)     {}
+func (p testPlugin) Shutdown()                             {}
+func (p testPlugin) Init() error                           { *p.inits++; return p.initErr }
+
+func TestRegister(t *testing.T) {
+	defer Shutdown()
+	var inits int
+	Register(testPlugin{name: "a", inits: &inits}, testPlugin{name: "b", inits: &inits})
+	// 重复注册不会重复初始化
+	Register(testPlugin{name: "a", inits: &inits})
+	Register(testPlugin{name: "c", inits: &inits, initErr: errors.New("初始化失败")})
+
+	list := Plugins()
+	if len(list) != 2 || list[0].Name() != "a" || list[1].Name() != "b" {
+		t.Fatalf("注册结果错误: %v", list)
+	}
+	if inits != 3 {
+		t.Fatalf("初始化次数错误: %v", inits)
+	}
+	if GetPlugin("c") != nil {
+		t.Fatal("初始化失败的插件不应该注册")
+	}
+}
@@ -1,19 +1,92 @@
 package plugins
 
-import "github.com/eatmoreapple/openwechat"
-
-// Status
-// @description: 处理插件相关指令
-// @receiver p
-// @param ctx
-func (p weChatPlugin) Status(ctx *openwechat.MessageContext) {
-	switch ctx.Content {
-	case "开启插件":
-		ChangePluginStatus(true)
-		_, _ = ctx.ReplyText("插件已开启")
-	case "关闭插件":
-		ChangePluginStatus(false)
-		_, _ = ctx.ReplyText("插件已关闭")
-	}
-	ctx.Next()
+import (
+	"fmt"
+	"strings"
+)
+
+// 插件开关插件名称
+const statusPluginName = "status"
+
+// StatusPlugin 处理插件开关指令，只修改发出指令的会话，插件关闭之后也会处理，默认需要管理员权限
+type StatusPlugin struct {
+	CommandPlugin
+}
+
+func (StatusPlugin) Name() string        { return statusPluginName }
+func (StatusPlugin) Description() string { return "开启、关闭当前会话的插件" }
+func (StatusPlugin) RequiredRole() Role  { return RoleAdmin }
+
+func (p StatusPlugin) Commands() []Command {
+	return []Command{
+		{Name: "开启插件", Aliases: []string{"enable"}, Usage: "[插件名称]", Description: "开启当前会话的全部插件，指定插件名称的时候只开启这个插件", Handler: p.enable},
+		{Name: "关闭插件", Aliases: []string{"disable"}, Usage: "[插件名称]", Description: "关闭当前会话的全部插件，指定插件名称的时候只关闭这个插件", Handler: p.disable},
+		{Name: "插件状态", Aliases: []string{"plugins"}, Description: "查看当前会话的插件状态", Handler: p.status},
+	}
+}
+
+func (p StatusPlugin) enable(c *CommandContext) error {
+	return p.change(c, true)
+}
+
+func (p StatusPlugin) disable(c *CommandContext) error {
+	return p.change(c, false)
+}
+
+// 开启或关闭插件
+func (p StatusPlugin) change(c *CommandContext, open bool) error {
+	if len(c.Args) > 1 {
+		return ErrUsage
+	}
+	s, err := loadChatSwitch(c.MessageContext)
+	if err != nil {
+		return err
+	}
+	action := "开启"
+	if !open {
+		action = "关闭"
+	}
+	target := "插件"
+	if len(c.Args) == 0 {
+		err = s.setAll(open)
+	} else {
+		name := c.Args[0]
+		if GetPlugin(name) == nil || alwaysOnPlugins[name] {
+			_, _ = replyText(c.MessageContext, p.Name(), fmt.Sprintf("插件[%v]不存在或者不能%v", name, action))
+			return nil
+		}
+		err = s.set(name, open)
+		target = fmt.Sprintf("插件[%v]", name)
+	}
+	if err != nil {
+		return err
+	}
+	_, _ = replyText(c.MessageContext, p.Name(), fmt.Sprintf("当前会话%v已%v", target, action))
+	return nil
+}
+
+// 查看插件状态
+func (p StatusPlugin) status(c *CommandContext) error {
+	s, err := loadChatSwitch(c.MessageContext)
+	if err != nil {
+		return err
+	}
+	_, _ = replyText(c.MessageContext, p.Name(), s.summary())
+	return nil
+}
+
+// 当前会话各个插件的开关状态
+func (s *chatSwitch) summary() string {
+	lines := []string{"当前会话插件状态:"}
+	for _, plugin := range Plugins() {
+		if alwaysOnPlugins[plugin.Name()] {
+			continue
+		}
+		state := "已开启"
+		if !s.enabled(plugin.Name()) {
+			state = "已关闭"
+		}
+		lines = append(lines, fmt.Sprintf("%v(%v): %v", plugin.Name(), plugin.Description(), state))
+	}
+	return strings.Join(lines, "\n")
 }
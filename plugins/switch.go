@@ -0,0 +1,80 @@
+package plugins
+
+import (
+	"github.com/eatmoreapple/openwechat"
+	"web-wechat/core"
+	. "web-wechat/db"
+	"web-wechat/utils"
+)
+
+// 开关配置里表示全部插件的字段
+const allPlugins = "*"
+
+// 生成保存插件开关的Redis Key，每个AppKey的每个会话一个Hash，字段为插件名称
+func switchKey(appKey, chatId string) string {
+	return "wechat:plugin:" + appKey + ":" + chatId
+}
+
+// 消息所在的会话，群消息为群组，私聊为对方，自己发出的消息为收信人
+func messageChat(ctx *openwechat.MessageContext) (*openwechat.User, error) {
+	if ctx.IsSendBySelf() {
+		return ctx.Receiver()
+	}
+	return ctx.Sender()
+}
+
+// 消息所在会话的插件开关
+type chatSwitch struct {
+	appKey string
+	chatId string
+	values map[string]string // 插件名称 => 1开启 0关闭
+}
+
+// 读取消息所在会话的插件开关
+func loadChatSwitch(ctx *openwechat.MessageContext) (*chatSwitch, error) {
+	s := &chatSwitch{appKey: core.AppKeyFromContext(ctx.Bot().Context())}
+	chat, err := messageChat(ctx)
+	if err != nil {
+		return nil, err
+	}
+	s.chatId = utils.GetUserId(chat)
+	if s.values, err = RedisClient.HGetAll(switchKey(s.appKey, s.chatId)); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// 插件是否开启，先看插件自己的开关，再看全部插件的开关，都没有设置的时候默认开启
+func (s *chatSwitch) enabled(name string) bool {
+	if v, ok := s.values[name]; ok {
+		return v == "1"
+	}
+	if v, ok := s.values[allPlugins]; ok {
+		return v == "1"
+	}
+	return true
+}
+
+// 开启或关闭全部插件，会清掉单个插件的开关
+func (s *chatSwitch) setAll(open bool) error {
+	if err := RedisClient.Del(switchKey(s.appKey, s.chatId)); err != nil {
+		return err
+	}
+	s.values = make(map[string]string)
+	if open {
+		// 默认就是开启，不需要保存
+		return nil
+	}
+	s.values[allPlugins] = "0"
+	return RedisClient.HSet(switchKey(s.appKey, s.chatId), allPlugins, "0")
+}
+
+// 开启或关闭单个插件
+func (s *chatSwitch) set(name string, open bool) error {
+	value := "0"
+	if open {
+		value = "1"
+	}
+	s.values[name] = value
+	return RedisClient.HSet(switchKey(s.appKey, s.chatId), name, value)
+}
@@ -0,0 +1,14 @@
+package plugins
+
+import "testing"
+
+func TestChatSwitchEnabled(t *testing.T) {
+	s := &chatSwitch{}
+	if !s.enabled("holiday") {
+		t.Fatal("没有设置的时候默认开启")
+	}
+	s.values = map[string]string{allPlugins: "0", "holiday": "1"}
+	if !s.enabled("holiday") || s.enabled("off_work") {
+		t.Fatalf("插件自己的开关优先于全部插件的开关: %v", s.values)
+	}
+}
@@ -0,0 +1,16 @@
+package route
+
+import (
+	"github.com/gin-gonic/gin"
+	"web-wechat/controller"
+)
+
+// 初始化媒体文件相关路由
+func initMediaRoute(app *gin.Engine) {
+	group := app.Group("/media")
+
+	// 获取消息的媒体文件
+	group.GET("/:messageId", controller.GetMediaHandle)
+	// 预览按保留策略会被清理的媒体文件
+	group.GET("/retention", controller.GetMediaRetentionReportHandle)
+}
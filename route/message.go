@@ -14,4 +14,7 @@ func initMessageRoute(app *gin.Engine) {
 
 	// 向指定群组发送消息
 	group.PUT("/group", controller.SendMessageToGroup)
+
+	// 查询历史消息
+	group.GET("/history", controller.GetMessageHistoryHandle)
 }
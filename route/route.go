@@ -14,4 +14,13 @@ func InitRoute(app *gin.Engine) {
 
 	// 初始化消息模块路由
 	initMessageRoute(app)
+
+	// 初始化媒体文件路由
+	initMediaRoute(app)
+
+	// 初始化Webhook路由
+	initWebhookRoute(app)
+
+	// 初始化WebSocket路由
+	initWebSocketRoute(app)
 }
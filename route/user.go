@@ -13,4 +13,8 @@ func initUserRoute(app *gin.Engine) {
 	group.GET("/info", controller.GetCurrentUserInfoHandle)
 	// 获取好友列表
 	group.GET("/friends", controller.GetFriendsListHandle)
+	// 获取联系人头像
+	group.GET("/avatar/:id", controller.GetUserAvatarHandle)
+	// 导出联系人
+	group.GET("/export", controller.ExportContactsHandle)
 }
@@ -0,0 +1,18 @@
+package route
+
+import (
+	"github.com/gin-gonic/gin"
+	"web-wechat/controller"
+)
+
+// 初始化Webhook相关路由
+func initWebhookRoute(app *gin.Engine) {
+	group := app.Group("/webhook")
+
+	// 获取Webhook配置
+	group.GET("", controller.GetWebhookConfigHandle)
+	// 保存Webhook配置
+	group.PUT("", controller.SaveWebhookConfigHandle)
+	// 删除Webhook配置
+	group.DELETE("", controller.DeleteWebhookConfigHandle)
+}
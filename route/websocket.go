@@ -0,0 +1,14 @@
+package route
+
+import (
+	"github.com/gin-gonic/gin"
+	"web-wechat/controller"
+)
+
+// 初始化WebSocket相关路由
+func initWebSocketRoute(app *gin.Engine) {
+	group := app.Group("/ws")
+
+	// 实时收发消息
+	group.GET("/messages", controller.MessageWebSocketHandle)
+}
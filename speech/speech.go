@@ -0,0 +1,61 @@
+package speech
+
+import (
+	"context"
+	"errors"
+	"gitee.ltd/lxh/logger/log"
+	"sync"
+	"web-wechat/core"
+)
+
+// ErrNotEnabled 没有配置语音识别
+var ErrNotEnabled = errors.New("语音识别未启用")
+
+// Transcriber 语音转文字接口，接入其他语音识别服务实现这个接口即可
+type Transcriber interface {
+	// Transcribe 识别语音内容，contentType为音频的MIME类型
+	Transcribe(ctx context.Context, audio []byte, contentType string) (string, error)
+}
+
+var (
+	transcriber Transcriber
+	mu          sync.RWMutex
+)
+
+// InitTranscriber 根据配置初始化语音识别
+func InitTranscriber() {
+	conf := core.SystemConfig.SpeechConfig
+	switch conf.Provider {
+	case "":
+		log.Info("未配置语音识别，语音消息只保存音频")
+	case "static":
+		SetTranscriber(StaticTranscriber{Text: conf.Text})
+	default:
+		log.Errorf("不支持的语音识别服务: %v", conf.Provider)
+	}
+}
+
+// SetTranscriber 设置语音识别实现，传nil关闭语音识别
+func SetTranscriber(t Transcriber) {
+	mu.Lock()
+	defer mu.Unlock()
+	transcriber = t
+}
+
+// Enabled 是否启用了语音识别
+func Enabled() bool {
+	mu.RLock()
+	defer mu.RUnlock()
+	return transcriber != nil
+}
+
+// Transcribe 使用当前的语音识别实现识别语音内容
+func Transcribe(ctx context.Context, audio []byte, contentType string) (string, error) {
+	mu.RLock()
+	t := transcriber
+	mu.RUnlock()
+	if t == nil {
+		return "", ErrNotEnabled
+	}
+	return t.Transcribe(ctx, audio, contentType)
+}
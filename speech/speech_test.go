@@ -0,0 +1,27 @@
+package speech
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestTranscribe(t *testing.T) {
+	SetTranscriber(nil)
+	if _, err := Transcribe(context.Background(), []byte("audio"), "audio/mpeg"); !errors.Is(err, ErrNotEnabled) {
+		t.Fatalf("未启用时应该返回ErrNotEnabled，实际: %v", err)
+	}
+
+	SetTranscriber(StaticTranscriber{Text: "你好"})
+	defer SetTranscriber(nil)
+	if !Enabled() {
+		t.Fatal("设置之后应该是启用状态")
+	}
+	text, err := Transcribe(context.Background(), []byte("audio"), "audio/mpeg")
+	if err != nil || text != "你好" {
+		t.Fatalf("识别结果错误: %v, %v", text, err)
+	}
+	if _, err = Transcribe(context.Background(), nil, "audio/mpeg"); err == nil {
+		t.Fatal("空音频应该返回错误")
+	}
+}
@@ -0,0 +1,22 @@
+package speech
+
+import (
+	"context"
+	"errors"
+)
+
+// StaticTranscriber 本地替身实现，不调用任何服务，直接返回固定内容，用于测试和联调
+type StaticTranscriber struct {
+	Text string // 识别结果
+}
+
+// Transcribe 返回固定内容，空音频返回错误
+func (s StaticTranscriber) Transcribe(ctx context.Context, audio []byte, contentType string) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	if len(audio) == 0 {
+		return "", errors.New("音频内容为空")
+	}
+	return s.Text, nil
+}
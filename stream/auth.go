@@ -0,0 +1,43 @@
+package stream
+
+import (
+	"github.com/gorilla/websocket"
+	"net/http"
+	"net/url"
+	"strings"
+	"web-wechat/core"
+)
+
+// AppKeyProtocol 浏览器没法自定义请求头，通过子协议传入AppKey: new WebSocket(url, ["appkey", AppKey])
+const AppKeyProtocol = "appkey"
+
+// ProtocolAppKey 从Sec-WebSocket-Protocol里取出AppKey，没有传的时候返回空
+func ProtocolAppKey(r *http.Request) string {
+	protocols := websocket.Subprotocols(r)
+	for i, p := range protocols {
+		if p == AppKeyProtocol && i+1 < len(protocols) {
+			return protocols[i+1]
+		}
+	}
+	return ""
+}
+
+// CheckOrigin 检查网页来源，不带Origin的非浏览器客户端不限制
+// 配置了websocket.allowOrigins的时候只允许列表里的来源，*为不限制，没有配置的时候只允许同源
+func CheckOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	allowed := core.SystemConfig.WsConfig.AllowOrigins
+	if len(allowed) == 0 {
+		u, err := url.Parse(origin)
+		return err == nil && strings.EqualFold(u.Host, r.Host)
+	}
+	for _, a := range allowed {
+		if a == "*" || strings.EqualFold(strings.TrimRight(a, "/"), origin) {
+			return true
+		}
+	}
+	return false
+}
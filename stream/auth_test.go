@@ -0,0 +1,44 @@
+package stream
+
+import (
+	"net/http/httptest"
+	"testing"
+	"web-wechat/core"
+)
+
+func TestProtocolAppKey(t *testing.T) {
+	r := httptest.NewRequest("GET", "/ws/messages", nil)
+	r.Header.Set("Sec-WebSocket-Protocol", "appkey, abc123")
+	if key := ProtocolAppKey(r); key != "abc123" {
+		t.Fatalf("应该从子协议取出AppKey，实际: %v", key)
+	}
+	r.Header.Set("Sec-WebSocket-Protocol", "appkey")
+	if key := ProtocolAppKey(r); key != "" {
+		t.Fatalf("没有AppKey的时候应该返回空，实际: %v", key)
+	}
+}
+
+func TestCheckOrigin(t *testing.T) {
+	old := core.SystemConfig.WsConfig.AllowOrigins
+	defer func() { core.SystemConfig.WsConfig.AllowOrigins = old }()
+
+	check := func(origin string) bool {
+		r := httptest.NewRequest("GET", "http://wechat.example.com/ws/messages", nil)
+		if origin != "" {
+			r.Header.Set("Origin", origin)
+		}
+		return CheckOrigin(r)
+	}
+	core.SystemConfig.WsConfig.AllowOrigins = nil
+	if !check("") || !check("http://wechat.example.com") || check("https://evil.example.com") {
+		t.Fatal("没有配置的时候只允许同源和非浏览器客户端")
+	}
+	core.SystemConfig.WsConfig.AllowOrigins = []string{"https://admin.example.com/"}
+	if !check("https://admin.example.com") || check("http://wechat.example.com") || check("https://evil.example.com") {
+		t.Fatal("配置了来源的时候只允许列表里的来源")
+	}
+	core.SystemConfig.WsConfig.AllowOrigins = []string{"*"}
+	if !check("https://evil.example.com") {
+		t.Fatal("配置*的时候不限制来源")
+	}
+}
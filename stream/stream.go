@@ -0,0 +1,123 @@
+package stream
+
+import (
+	"encoding/json"
+	"gitee.ltd/lxh/logger/log"
+	"github.com/gorilla/websocket"
+	"sync"
+	"time"
+	"web-wechat/event"
+)
+
+const (
+	writeWait  = 10 * time.Second  // 单次写入超时时间
+	pongWait   = 60 * time.Second  // 等待客户端响应心跳的时间
+	pingPeriod = pongWait * 9 / 10 // 发送心跳的间隔，需要比pongWait短
+	sendBuffer = 256               // 每个连接待发送消息的缓冲数量
+)
+
+// Client WebSocket客户端连接
+type Client struct {
+	appKey string
+	conn   *websocket.Conn
+	send   chan []byte
+	once   sync.Once
+}
+
+var (
+	// 每个AppKey下的所有连接
+	clients = make(map[string]map[*Client]struct{})
+	mu      sync.RWMutex
+)
+
+// Register 注册一个连接并开始推送数据
+func Register(appKey string, conn *websocket.Conn) *Client {
+	client := &Client{appKey: appKey, conn: conn, send: make(chan []byte, sendBuffer)}
+	mu.Lock()
+	if clients[appKey] == nil {
+		clients[appKey] = make(map[*Client]struct{})
+	}
+	clients[appKey][client] = struct{}{}
+	mu.Unlock()
+
+	_ = conn.SetReadDeadline(time.Now().Add(pongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(pongWait))
+	})
+	go client.writePump()
+	return client
+}
+
+// SendJSON 发送JSON数据给客户端，缓冲区满了直接丢弃，避免慢连接阻塞消息处理
+func (c *Client) SendJSON(data interface{}) {
+	b, err := json.Marshal(data)
+	if err != nil {
+		log.Errorf("[%v]WebSocket数据序列化失败: %v", c.appKey, err.Error())
+		return
+	}
+	mu.RLock()
+	defer mu.RUnlock()
+	if _, exist := clients[c.appKey][c]; !exist {
+		return
+	}
+	select {
+	case c.send <- b:
+	default:
+		log.Errorf("[%v]WebSocket发送缓冲区已满，丢弃数据", c.appKey)
+	}
+}
+
+// Close 注销连接并关闭
+func (c *Client) Close() {
+	c.once.Do(func() {
+		mu.Lock()
+		delete(clients[c.appKey], c)
+		if len(clients[c.appKey]) == 0 {
+			delete(clients, c.appKey)
+		}
+		close(c.send)
+		mu.Unlock()
+	})
+}
+
+// 把缓冲区的数据写到连接，并定时发送心跳
+func (c *Client) writePump() {
+	ticker := time.NewTicker(pingPeriod)
+	defer func() {
+		ticker.Stop()
+		_ = c.conn.Close()
+	}()
+	for {
+		select {
+		case data, ok := <-c.send:
+			_ = c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if !ok {
+				// 连接已注销
+				_ = c.conn.WriteMessage(websocket.CloseMessage, []byte{})
+				return
+			}
+			if err := c.conn.WriteMessage(websocket.TextMessage, data); err != nil {
+				log.Debugf("[%v]WebSocket写入失败: %v", c.appKey, err.Error())
+				return
+			}
+		case <-ticker.C:
+			_ = c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// EventHandle 把事件推送给对应AppKey的所有连接
+func EventHandle(e event.Event) {
+	mu.RLock()
+	list := make([]*Client, 0, len(clients[e.AppKey]))
+	for client := range clients[e.AppKey] {
+		list = append(list, client)
+	}
+	mu.RUnlock()
+	for _, client := range list {
+		client.SendJSON(e)
+	}
+}
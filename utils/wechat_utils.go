@@ -0,0 +1,15 @@
+package utils
+
+import "github.com/eatmoreapple/openwechat"
+
+// GetUserId 获取联系人的唯一标识
+// 优先使用多次登录不会变化的ID，获取不到的时候才使用当前会话有效的UserName
+func GetUserId(user *openwechat.User) string {
+	if user == nil {
+		return ""
+	}
+	if id := user.ID(); id != "" {
+		return id
+	}
+	return user.UserName
+}
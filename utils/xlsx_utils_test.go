@@ -0,0 +1,79 @@
+package utils
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"testing"
+)
+
+func TestXlsxColumnName(t *testing.T) {
+	cases := map[int]string{0: "A", 25: "Z", 26: "AA", 27: "AB", 51: "AZ", 52: "BA", 701: "ZZ", 702: "AAA"}
+	for index, want := range cases {
+		if name := xlsxColumnName(index); name != want {
+			t.Fatalf("第%v列的列名应该是%v，实际: %v", index, want, name)
+		}
+	}
+}
+
+// 工作表里的单元格
+type xlsxTestSheet struct {
+	Rows []struct {
+		R     int `xml:"r,attr"`
+		Cells []struct {
+			R    string `xml:"r,attr"`
+			Text string `xml:"is>t"`
+		} `xml:"c"`
+	} `xml:"sheetData>row"`
+}
+
+func TestWriteXlsx(t *testing.T) {
+	// 超过26列，检查Z之后的列名
+	header := make([]string, 28)
+	row := make([]string, 28)
+	for i := range header {
+		header[i] = fmt.Sprintf("col%v", i)
+		row[i] = fmt.Sprintf("值%v", i)
+	}
+	row[27] = `<张三> & "李四"`
+	var buf bytes.Buffer
+	if err := WriteXlsx(&buf, "contacts", [][]string{header, row}); err != nil {
+		t.Fatal(err)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("不是有效的压缩包: %v", err)
+	}
+	files := make(map[string][]byte)
+	for _, f := range zr.File {
+		r, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[f.Name], _ = io.ReadAll(r)
+		_ = r.Close()
+	}
+	for _, name := range []string{"[Content_Types].xml", "_rels/.rels", "xl/_rels/workbook.xml.rels", "xl/workbook.xml", "xl/worksheets/sheet1.xml"} {
+		if _, ok := files[name]; !ok {
+			t.Fatalf("缺少文件: %v", name)
+		}
+	}
+
+	var sheet xlsxTestSheet
+	if err = xml.Unmarshal(files["xl/worksheets/sheet1.xml"], &sheet); err != nil {
+		t.Fatalf("工作表不是有效的XML: %v", err)
+	}
+	if len(sheet.Rows) != 2 || sheet.Rows[1].R != 2 || len(sheet.Rows[1].Cells) != 28 {
+		t.Fatalf("行数或者列数错误: %+v", sheet.Rows)
+	}
+	cells := sheet.Rows[1].Cells
+	if cells[25].R != "Z2" || cells[26].R != "AA2" || cells[27].R != "AB2" {
+		t.Fatalf("单元格位置错误: %v, %v, %v", cells[25].R, cells[26].R, cells[27].R)
+	}
+	if cells[0].Text != "值0" || cells[27].Text != row[27] {
+		t.Fatalf("单元格内容错误: %v, %v", cells[0].Text, cells[27].Text)
+	}
+}
@@ -0,0 +1,47 @@
+package webhook
+
+import (
+	"encoding/json"
+	. "web-wechat/db"
+)
+
+// Config AppKey的Webhook配置
+type Config struct {
+	Url    string `json:"url"`    // 推送地址
+	Secret string `json:"secret"` // 签名密钥
+}
+
+// 生成保存配置的Redis Key
+func configKey(appKey string) string {
+	return "wechat:webhook:" + appKey
+}
+
+// GetConfig 获取AppKey的Webhook配置，未配置返回nil
+func GetConfig(appKey string) (*Config, error) {
+	data, err := RedisClient.GetData(configKey(appKey))
+	if err != nil {
+		if IsRedisNil(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var conf Config
+	if err = json.Unmarshal([]byte(data), &conf); err != nil {
+		return nil, err
+	}
+	return &conf, nil
+}
+
+// SaveConfig 保存AppKey的Webhook配置
+func SaveConfig(appKey string, conf Config) error {
+	data, err := json.Marshal(conf)
+	if err != nil {
+		return err
+	}
+	return RedisClient.Set(configKey(appKey), string(data))
+}
+
+// DeleteConfig 删除AppKey的Webhook配置
+func DeleteConfig(appKey string) error {
+	return RedisClient.Del(configKey(appKey))
+}
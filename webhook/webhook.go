@@ -0,0 +1,143 @@
+package webhook
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gitee.ltd/lxh/logger/log"
+	"io"
+	"net/http"
+	"time"
+	"web-wechat/core"
+	. "web-wechat/db"
+	"web-wechat/event"
+)
+
+// 推送失败的消息保存的表名
+const deadLetterTableName = "webhook_dead_letter"
+
+// 推送失败的记录
+type deadLetter struct {
+	AppKey    string
+	Url       string
+	Event     string
+	Payload   string
+	Attempts  int
+	LastError string
+	CreatedAt time.Time
+}
+
+// 同时在推送(包括等待重试)的事件数量上限，超过的直接保存到死信表，避免推送地址故障的时候协程无限增加
+const maxDeliveries = 256
+
+// 推送名额
+var deliverySlots = make(chan struct{}, maxDeliveries)
+
+// EventHandle 异步推送事件到AppKey配置的Webhook
+func EventHandle(e event.Event) {
+	conf, err := GetConfig(e.AppKey)
+	if err != nil {
+		log.Errorf("[%v]读取Webhook配置失败: %v", e.AppKey, err.Error())
+		return
+	}
+	// 没有配置推送地址，跳过
+	if conf == nil || conf.Url == "" {
+		return
+	}
+	body, err := json.Marshal(e)
+	if err != nil {
+		log.Errorf("[%v]Webhook数据序列化失败: %v", e.AppKey, err.Error())
+		return
+	}
+	select {
+	case deliverySlots <- struct{}{}:
+		go func() {
+			defer func() { <-deliverySlots }()
+			deliver(e.AppKey, e.Type, *conf, body)
+		}()
+	default:
+		log.Errorf("[%v]Webhook待推送的事件过多，直接保存到死信表", e.AppKey)
+		saveDeadLetter(e.AppKey, e.Type, *conf, body, 0, errors.New("待推送的事件过多"))
+	}
+}
+
+// 推送数据，最终失败的保存到死信表
+func deliver(appKey, event string, conf Config, body []byte) {
+	attempts, err := sendWithRetry(appKey, event, conf, body)
+	if err != nil {
+		saveDeadLetter(appKey, event, conf, body, attempts, err)
+	}
+}
+
+// 推送数据，失败之后按1s、2s、4s...的间隔重试，返回推送次数和最后一次的错误
+func sendWithRetry(appKey, event string, conf Config, body []byte) (int, error) {
+	maxRetry := core.SystemConfig.WebhookConfig.MaxRetry
+	if maxRetry < 0 {
+		maxRetry = 0
+	}
+	var err error
+	attempts := 0
+	for attempts <= maxRetry {
+		if attempts > 0 {
+			time.Sleep(time.Duration(1<<(attempts-1)) * time.Second)
+		}
+		attempts++
+		if err = send(event, conf, body); err == nil {
+			log.Debugf("[%v]Webhook推送成功: %v", appKey, conf.Url)
+			return attempts, nil
+		}
+		log.Errorf("[%v]Webhook第%v次推送失败: %v", appKey, attempts, err.Error())
+	}
+	return attempts, err
+}
+
+// 保存推送失败的记录
+func saveDeadLetter(appKey, event string, conf Config, body []byte, attempts int, err error) {
+	MongoClient.Save(deadLetter{
+		AppKey:    appKey,
+		Url:       conf.Url,
+		Event:     event,
+		Payload:   string(body),
+		Attempts:  attempts,
+		LastError: err.Error(),
+		CreatedAt: time.Now(),
+	}, deadLetterTableName)
+}
+
+// 发送一次推送请求
+func send(event string, conf Config, body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, conf.Url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Webhook-Event", event)
+	req.Header.Set("X-Webhook-Signature", "sha256="+Sign(conf.Secret, body))
+
+	timeout := core.SystemConfig.WebhookConfig.Timeout
+	if timeout <= 0 {
+		timeout = 10
+	}
+	client := http.Client{Timeout: time.Duration(timeout) * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("响应状态码异常: %v", resp.StatusCode)
+	}
+	return nil
+}
+
+// Sign 使用HMAC-SHA256计算推送内容的签名，接收方用同样的密钥计算后比对即可校验来源
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
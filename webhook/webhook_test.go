@@ -0,0 +1,49 @@
+package webhook
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"web-wechat/core"
+)
+
+func TestSend(t *testing.T) {
+	body := []byte(`{"event":"message"}`)
+	conf := Config{Secret: "secret"}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		if r.Header.Get("X-Webhook-Signature") != "sha256="+Sign(conf.Secret, data) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	conf.Url = server.URL
+	if err := send("message", conf, body); err != nil {
+		t.Fatalf("推送失败: %v", err)
+	}
+	if err := send("message", Config{Url: server.URL, Secret: "wrong"}, body); err == nil {
+		t.Fatal("签名错误的时候应该推送失败")
+	}
+}
+
+func TestSendWithRetryNegativeMaxRetry(t *testing.T) {
+	old := core.SystemConfig.WebhookConfig.MaxRetry
+	defer func() { core.SystemConfig.WebhookConfig.MaxRetry = old }()
+	core.SystemConfig.WebhookConfig.MaxRetry = -1
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	// 重试次数配置成负数的时候至少推送一次，并返回错误
+	attempts, err := sendWithRetry("test", "message.received", Config{Url: server.URL}, []byte(`{}`))
+	if attempts != 1 || err == nil {
+		t.Fatalf("应该推送一次并返回错误，实际: %v, %v", attempts, err)
+	}
+}